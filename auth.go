@@ -7,6 +7,7 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -36,6 +37,16 @@ type AuthMiddleware struct {
 	enabled   bool
 	logger    Logger
 
+	// Accepted iss / aud claim values. A token must carry one of the
+	// issuers and at least one of the audiences. GenerateToken mints
+	// tokens with the first of each.
+	issuers   []string
+	audiences []string
+
+	// RS256 signing keys from GEMINI_AUTH_JWKS_URL; nil when only the
+	// shared HS256 secret is configured.
+	jwks *jwksCache
+
 	// Injectable clock so tests can step time deterministically.
 	nowFn func() time.Time
 
@@ -51,14 +62,53 @@ type Claims struct {
 	jwt.RegisteredClaims
 }
 
+// AuthOption customizes an AuthMiddleware.
+type AuthOption func(*AuthMiddleware)
+
+// WithAuthIssuers replaces the accepted iss values (default "gemini-mcp").
+// Empty input keeps the default.
+func WithAuthIssuers(issuers ...string) AuthOption {
+	return func(a *AuthMiddleware) {
+		if len(issuers) > 0 {
+			a.issuers = issuers
+		}
+	}
+}
+
+// WithAuthAudiences replaces the accepted aud values (default
+// "gemini-mcp-user"). Empty input keeps the default.
+func WithAuthAudiences(audiences ...string) AuthOption {
+	return func(a *AuthMiddleware) {
+		if len(audiences) > 0 {
+			a.audiences = audiences
+		}
+	}
+}
+
+// WithAuthJWKS verifies RS256 tokens against the key set published at url.
+// A nil client uses a default with a short timeout. Empty url is a no-op.
+func WithAuthJWKS(url string, client *http.Client) AuthOption {
+	return func(a *AuthMiddleware) {
+		if url != "" {
+			a.jwks = newJWKSCache(url, client)
+		}
+	}
+}
+
 // NewAuthMiddleware creates a new authentication middleware
-func NewAuthMiddleware(secretKey string, enabled bool, logger Logger) *AuthMiddleware {
-	return &AuthMiddleware{
+func NewAuthMiddleware(secretKey string, enabled bool, logger Logger, opts ...AuthOption) *AuthMiddleware {
+	a := &AuthMiddleware{
 		secretKey: []byte(secretKey),
 		enabled:   enabled,
 		logger:    logger,
+		issuers:   []string{defaultAuthIssuer},
+		audiences: []string{defaultAuthAudience},
 		logState:  make(map[string]*authLogState),
 	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
 }
 
 // now returns the current time, honoring the injectable clock if set.
@@ -205,7 +255,7 @@ func (a *AuthMiddleware) HTTPContextFunc(
 		}
 
 		// Validate JWT token
-		claims, err := a.validateJWT(tokenString)
+		claims, err := a.validateJWT(ctx, tokenString)
 		if err != nil {
 			var authErr string
 			switch {
@@ -247,17 +297,25 @@ func (a *AuthMiddleware) HTTPContextFunc(
 	}
 }
 
-// validateJWT validates a JWT token and returns the claims
-func (a *AuthMiddleware) validateJWT(tokenString string) (*Claims, error) {
+// validateJWT validates a JWT token and returns the claims. ctx bounds any
+// JWKS fetch the token's kid triggers.
+func (a *AuthMiddleware) validateJWT(ctx context.Context, tokenString string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (any, error) {
-		// Pin to specific HS256 algorithm for enhanced security
-		if token.Method != jwt.SigningMethodHS256 {
+		// Pin each key source to exactly one algorithm: HS256 for the shared
+		// secret, RS256 for JWKS keys. Anything else is rejected.
+		switch {
+		case token.Method == jwt.SigningMethodHS256 && len(a.secretKey) > 0:
+			return a.secretKey, nil
+		case token.Method == jwt.SigningMethodRS256 && a.jwks != nil:
+			kid, _ := token.Header["kid"].(string)
+			if kid == "" {
+				return nil, fmt.Errorf("RS256 token has no kid header")
+			}
+			return a.jwks.key(ctx, kid)
+		default:
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		return a.secretKey, nil
 	},
-		jwt.WithIssuer("gemini-mcp"),
-		jwt.WithAudience("gemini-mcp-user"),
 		jwt.WithLeeway(60*time.Second),
 	)
 
@@ -265,11 +323,19 @@ func (a *AuthMiddleware) validateJWT(tokenString string) (*Claims, error) {
 		return nil, err // The library handles various parsing/validation errors
 	}
 
-	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
-		return claims, nil
+	claims, ok := token.Claims.(*Claims)
+	if !ok || !token.Valid {
+		return nil, fmt.Errorf("invalid token")
 	}
-
-	return nil, fmt.Errorf("invalid token")
+	// jwt.WithIssuer / WithAudience accept a single value, so the
+	// allowlists are checked here with the library's sentinel errors.
+	if !slices.Contains(a.issuers, claims.Issuer) {
+		return nil, fmt.Errorf("%w: %q", jwt.ErrTokenInvalidIssuer, claims.Issuer)
+	}
+	if !slices.ContainsFunc(claims.Audience, func(aud string) bool { return slices.Contains(a.audiences, aud) }) {
+		return nil, fmt.Errorf("%w: %v", jwt.ErrTokenInvalidAudience, []string(claims.Audience))
+	}
+	return claims, nil
 }
 
 // GenerateToken generates a JWT token for a user (utility function for testing/setup)
@@ -280,8 +346,8 @@ func (a *AuthMiddleware) GenerateToken(userID, username, role string, expiration
 		Username: username,
 		Role:     role,
 		RegisteredClaims: jwt.RegisteredClaims{
-			Issuer:    "gemini-mcp",
-			Audience:  jwt.ClaimStrings{"gemini-mcp-user"},
+			Issuer:    a.issuers[0],
+			Audience:  jwt.ClaimStrings{a.audiences[0]},
 			IssuedAt:  jwt.NewNumericDate(now),
 			ExpiresAt: jwt.NewNumericDate(now.Add(time.Duration(expirationHours) * time.Hour)),
 			NotBefore: jwt.NewNumericDate(now),
@@ -328,7 +394,11 @@ func CreateTokenCommand(secretKey, userID, username, role string, expirationHour
 	}
 
 	logger := NewLogger(LevelInfo)
-	auth := NewAuthMiddleware(secretKey, true, logger)
+	// Mint with the same iss/aud the server accepts so the token validates.
+	auth := NewAuthMiddleware(secretKey, true, logger,
+		WithAuthIssuers(parseEnvVarList("GEMINI_AUTH_ISSUER")...),
+		WithAuthAudiences(parseEnvVarList("GEMINI_AUTH_AUDIENCE")...),
+	)
 
 	token, err := auth.GenerateToken(userID, username, role, expirationHours)
 	if err != nil {
@@ -2,12 +2,18 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -221,7 +227,7 @@ func TestValidateJWT(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			claims, err := auth.validateJWT(tc.token)
+			claims, err := auth.validateJWT(context.Background(), tc.token)
 
 			if tc.shouldSucceed {
 				assert.NoError(t, err, "Expected no error for valid token")
@@ -259,7 +265,7 @@ func TestValidateJWT(t *testing.T) {
 		wrongAlgTokenString, err := wrongAlgToken.SignedString([]byte(secret))
 		require.NoError(t, err)
 
-		claims, err := auth.validateJWT(wrongAlgTokenString)
+		claims, err := auth.validateJWT(context.Background(), wrongAlgTokenString)
 		assert.Error(t, err, "Expected error for wrong algorithm")
 		assert.Nil(t, claims, "Expected no claims for wrong algorithm")
 		assert.Contains(t, err.Error(), "unexpected signing method", "Error should mention unexpected signing method")
@@ -514,3 +520,231 @@ func TestLogAuthWarn_ConcurrentSafe(t *testing.T) {
 			"each goroutine emits once and suppresses the rest")
 	}
 }
+
+func TestValidateJWTIssuerAudience(t *testing.T) {
+	secret := "test-secret-for-issuer-audience"
+	auth := NewAuthMiddleware(secret, true, NewLogger(LevelError),
+		WithAuthIssuers("https://idp.example.com", "gemini-mcp"),
+		WithAuthAudiences("mcp-api"),
+	)
+	sign := func(iss string, aud ...string) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+			UserID: "123",
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    iss,
+				Audience:  aud,
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			},
+		})
+		s, err := token.SignedString([]byte(secret))
+		require.NoError(t, err)
+		return s
+	}
+
+	for _, tt := range []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{"custom issuer and audience", sign("https://idp.example.com", "mcp-api"), nil},
+		{"second allowed issuer", sign("gemini-mcp", "other", "mcp-api"), nil},
+		{"issuer mismatch", sign("https://evil.example.com", "mcp-api"), jwt.ErrTokenInvalidIssuer},
+		{"audience mismatch", sign("https://idp.example.com", "gemini-mcp-user"), jwt.ErrTokenInvalidAudience},
+		{"no audience", sign("https://idp.example.com"), jwt.ErrTokenInvalidAudience},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := auth.validateJWT(context.Background(), tt.token)
+			if tt.wantErr == nil {
+				require.NoError(t, err)
+				assert.Equal(t, "123", claims.UserID)
+				return
+			}
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.Nil(t, claims)
+		})
+	}
+
+	minted, err := auth.GenerateToken("1", "u", "user", 1)
+	require.NoError(t, err)
+	claims, err := auth.validateJWT(context.Background(), minted)
+	require.NoError(t, err)
+	assert.Equal(t, "https://idp.example.com", claims.Issuer)
+}
+
+func TestValidateJWTWithJWKS(t *testing.T) {
+	newKey := func() *rsa.PrivateKey {
+		k, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+		return k
+	}
+	publish := func(kid string, k *rsa.PrivateKey) map[string]string {
+		return map[string]string{
+			"kty": "RSA", "kid": kid, "use": "sig", "alg": "RS256",
+			"n": base64.RawURLEncoding.EncodeToString(k.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes()),
+		}
+	}
+	sign := func(kid string, k *rsa.PrivateKey) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, Claims{
+			UserID: "idp-user",
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    "gemini-mcp",
+				Audience:  jwt.ClaimStrings{"gemini-mcp-user"},
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			},
+		})
+		token.Header["kid"] = kid
+		s, err := token.SignedString(k)
+		require.NoError(t, err)
+		return s
+	}
+
+	key1, key2 := newKey(), newKey()
+	var (
+		mu        sync.Mutex
+		published = []map[string]string{publish("key-1", key1)}
+		fetches   atomic.Int32
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fetches.Add(1)
+		mu.Lock()
+		defer mu.Unlock()
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": published})
+	}))
+	defer srv.Close()
+
+	auth := NewAuthMiddleware("", true, NewLogger(LevelError), WithAuthJWKS(srv.URL, srv.Client()))
+
+	t.Run("published key validates", func(t *testing.T) {
+		claims, err := auth.validateJWT(context.Background(), sign("key-1", key1))
+		require.NoError(t, err)
+		assert.Equal(t, "idp-user", claims.UserID)
+		_, err = auth.validateJWT(context.Background(), sign("key-1", key1))
+		require.NoError(t, err)
+		assert.Equal(t, int32(1), fetches.Load(), "known kid must be served from cache")
+	})
+
+	t.Run("unknown kid rejected", func(t *testing.T) {
+		_, err := auth.validateJWT(context.Background(), sign("key-2", key2))
+		assert.ErrorContains(t, err, `unknown JWKS key id "key-2"`)
+	})
+
+	t.Run("wrong key for kid rejected", func(t *testing.T) {
+		_, err := auth.validateJWT(context.Background(), sign("key-1", key2))
+		assert.ErrorIs(t, err, jwt.ErrTokenSignatureInvalid)
+	})
+
+	t.Run("rotated key picked up on cache miss", func(t *testing.T) {
+		mu.Lock()
+		published = append(published, publish("key-2", key2))
+		mu.Unlock()
+		auth.jwks.minRefresh = 0
+		before := fetches.Load()
+		_, err := auth.validateJWT(context.Background(), sign("key-2", key2))
+		require.NoError(t, err)
+		assert.Equal(t, before+1, fetches.Load())
+	})
+
+	t.Run("HS256 rejected without shared secret", func(t *testing.T) {
+		hs := NewAuthMiddleware("test-secret-key-that-is-32-bytes!", true, NewLogger(LevelError))
+		token, err := hs.GenerateToken("1", "u", "user", 1)
+		require.NoError(t, err)
+		_, err = auth.validateJWT(context.Background(), token)
+		assert.ErrorContains(t, err, "unexpected signing method")
+	})
+}
+
+func TestJWKSCacheKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	good := map[string]string{
+		"kty": "RSA", "kid": "good", "use": "sig",
+		"n": base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()),
+		"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes()),
+	}
+
+	t.Run("malformed and non-RSA keys are skipped", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{
+				{"kty": "RSA", "kid": "bad", "n": "!!", "e": "AQAB"},
+				{"kty": "EC", "kid": "ec", "crv": "P-256"},
+				good,
+			}})
+		}))
+		defer srv.Close()
+		key, err := newJWKSCache(srv.URL, srv.Client()).key(context.Background(), "good")
+		require.NoError(t, err)
+		assert.Equal(t, rsaKey.N, key.N)
+	})
+
+	t.Run("failed fetch is throttled", func(t *testing.T) {
+		var fetches atomic.Int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			fetches.Add(1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer srv.Close()
+		cache := newJWKSCache(srv.URL, srv.Client())
+		_, err := cache.key(context.Background(), "good")
+		assert.ErrorContains(t, err, "fetching JWKS")
+		_, err = cache.key(context.Background(), "good")
+		assert.ErrorContains(t, err, `unknown JWKS key id "good"`)
+		assert.Equal(t, int32(1), fetches.Load())
+	})
+
+	t.Run("slow fetch does not block cached keys", func(t *testing.T) {
+		release := make(chan struct{})
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			<-release
+			_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{good}})
+		}))
+		defer srv.Close()
+		cache := newJWKSCache(srv.URL, srv.Client())
+		cache.keys = map[string]*rsa.PublicKey{"cached": &rsaKey.PublicKey}
+
+		missDone := make(chan error, 1)
+		go func() {
+			_, err := cache.key(context.Background(), "good")
+			missDone <- err
+		}()
+		require.Eventually(t, func() bool {
+			cache.mu.Lock()
+			defer cache.mu.Unlock()
+			return cache.inflight != nil
+		}, time.Second, time.Millisecond)
+
+		key, err := cache.key(context.Background(), "cached")
+		require.NoError(t, err)
+		assert.Same(t, &rsaKey.PublicKey, key)
+		close(release)
+		require.NoError(t, <-missDone)
+	})
+
+	t.Run("cancelled request stops the fetch", func(t *testing.T) {
+		release := make(chan struct{})
+		var fetches atomic.Int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if fetches.Add(1) == 1 {
+				select {
+				case <-release:
+				case <-r.Context().Done():
+				}
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{good}})
+		}))
+		defer srv.Close()
+		defer close(release)
+		cache := newJWKSCache(srv.URL, srv.Client())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		_, err := cache.key(ctx, "good")
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+		// A cancelled fetch does not count against the refresh throttle.
+		_, err = cache.key(context.Background(), "good")
+		require.NoError(t, err)
+		assert.Equal(t, int32(2), fetches.Load())
+	})
+}
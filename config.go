@@ -1,29 +1,43 @@
 package main
 
 import (
-	"errors"
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"maps"
 	"net"
 	"net/url"
 	"os"
+	"path/filepath"
+	"regexp"
 	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"text/template"
 	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
 // Default configuration values
 const (
 	defaultDeepSeekBaseURL   = "https://api.deepseek.com"
 	defaultGeminiTemperature = 1.0 // Gemini 3 default temperature
+	maxGeminiTemperature     = 2.0 // Upper bound accepted by both DeepSeek and Qwen
 	// Pre-qualification defaults
 	defaultPrequalify = true
+	// Escalation defaults
+	defaultEscalateOnEmpty = false
 	// GitHub settings defaults
 	defaultGitHubAPIBaseURL          = "https://api.github.com"
 	defaultMaxGitHubFiles            = 20
 	defaultMaxGitHubFileSize         = int64(1 * 1024 * 1024) // 1MB
+	defaultMinFileSize               = int64(0)               // 0 keeps every file, including empty ones
+	defaultMaxGitHubTotalBytes       = int64(0)               // 0 = no aggregate cap across github_files
 	defaultMaxGitHubDiffBytes        = int64(500 * 1024)      // 500KB for any single diff payload
 	defaultMaxGitHubCommits          = 10                     // max commits per github_commits call
+	defaultMaxGitHubTreeEntries      = 2000                   // max paths listed by github_tree
 	defaultMaxGitHubPRReviewComments = 50                     // max PR review comments fetched
 
 	// HTTP transport defaults
@@ -45,7 +59,16 @@ const (
 	defaultMaxConcurrentTasks = 10 // Upper bound on concurrently-executing task tools; <=0 disables.
 
 	// Authentication defaults
-	defaultAuthEnabled = false // Authentication disabled by default
+	defaultAuthEnabled  = false             // Authentication disabled by default
+	defaultAuthIssuer   = "gemini-mcp"      // iss claim minted and accepted by default
+	defaultAuthAudience = "gemini-mcp-user" // aud claim minted and accepted by default
+
+	// Response defaults
+	defaultAppendMetadata   = false // Trailing [model=… tokens=… elapsed=…] line on stdio answers
+	defaultResponseEnvelope = false // Plain-text answers; true returns a JSON envelope
+
+	// Trace defaults
+	defaultTraceFileContents = false // File contents stay out of GEMINI_TRACE_DIR unless opted in
 
 )
 
@@ -53,7 +76,7 @@ const (
 
 // Helper function to parse an integer environment variable with a default
 func parseEnvVarInt(key string, defaultValue int, logger Logger) int {
-	if str := os.Getenv(key); str != "" {
+	if str := getSetting(key); str != "" {
 		if val, err := strconv.Atoi(str); err == nil {
 			return val
 		}
@@ -64,7 +87,7 @@ func parseEnvVarInt(key string, defaultValue int, logger Logger) int {
 
 // Helper function to parse a float64 environment variable with a default
 func parseEnvVarFloat(key string, defaultValue float64, logger Logger) float64 {
-	if str := os.Getenv(key); str != "" {
+	if str := getSetting(key); str != "" {
 		if val, err := strconv.ParseFloat(str, 64); err == nil {
 			return val
 		}
@@ -75,7 +98,7 @@ func parseEnvVarFloat(key string, defaultValue float64, logger Logger) float64 {
 
 // Helper function to parse a duration environment variable with a default
 func parseEnvVarDuration(key string, defaultValue time.Duration, logger Logger) time.Duration {
-	if str := os.Getenv(key); str != "" {
+	if str := getSetting(key); str != "" {
 		if val, err := time.ParseDuration(str); err == nil {
 			return val
 		}
@@ -86,7 +109,7 @@ func parseEnvVarDuration(key string, defaultValue time.Duration, logger Logger)
 
 // Helper function to parse a boolean environment variable with a default
 func parseEnvVarBool(key string, defaultValue bool, logger Logger) bool {
-	if str := os.Getenv(key); str != "" {
+	if str := getSetting(key); str != "" {
 		if val, err := strconv.ParseBool(str); err == nil {
 			return val
 		}
@@ -95,6 +118,18 @@ func parseEnvVarBool(key string, defaultValue bool, logger Logger) bool {
 	return defaultValue
 }
 
+// parseEnvVarList splits a comma-separated environment variable into its
+// trimmed, non-empty entries. Returns nil when the variable is unset or empty.
+func parseEnvVarList(key string) []string {
+	var items []string
+	for _, p := range strings.Split(getSetting(key), ",") {
+		if trimmed := strings.TrimSpace(p); trimmed != "" {
+			items = append(items, trimmed)
+		}
+	}
+	return items
+}
+
 // isLoopbackHost reports whether host (with or without a port) resolves to a
 // loopback identifier per the RFC 9728 startup-validation rule. The accepted
 // set is intentionally narrow: "localhost", "127.0.0.1", and "::1". Used
@@ -166,11 +201,11 @@ type httpTransportConfig struct {
 
 func loadHTTPConfig(logger Logger) (httpTransportConfig, error) {
 	enableHTTP := parseEnvVarBool("GEMINI_ENABLE_HTTP", defaultEnableHTTP, logger)
-	address := os.Getenv("GEMINI_HTTP_ADDRESS")
+	address := getSetting("GEMINI_HTTP_ADDRESS")
 	if address == "" {
 		address = defaultHTTPAddress
 	}
-	path := os.Getenv("GEMINI_HTTP_PATH")
+	path := getSetting("GEMINI_HTTP_PATH")
 	if path == "" {
 		path = defaultHTTPPath
 	}
@@ -187,19 +222,12 @@ func loadHTTPConfig(logger Logger) (httpTransportConfig, error) {
 		logger,
 	)
 
-	var corsOrigins []string
-	if originsStr := os.Getenv("GEMINI_HTTP_CORS_ORIGINS"); originsStr != "" {
-		for _, p := range strings.Split(originsStr, ",") {
-			if trimmed := strings.TrimSpace(p); trimmed != "" {
-				corsOrigins = append(corsOrigins, trimmed)
-			}
-		}
-	}
+	corsOrigins := parseEnvVarList("GEMINI_HTTP_CORS_ORIGINS")
 	if len(corsOrigins) == 0 {
 		corsOrigins = []string{"*"}
 	}
 
-	publicURL, err := parseHTTPPublicURL(os.Getenv("GEMINI_HTTP_PUBLIC_URL"))
+	publicURL, err := parseHTTPPublicURL(getSetting("GEMINI_HTTP_PUBLIC_URL"))
 	if err != nil {
 		return httpTransportConfig{}, err
 	}
@@ -222,48 +250,200 @@ func loadHTTPConfig(logger Logger) (httpTransportConfig, error) {
 type authConfig struct {
 	enabled   bool
 	secretKey string
+	jwksURL   string
+	issuers   []string
+	audiences []string
 }
 
 func loadAuthConfig(logger Logger) (authConfig, error) {
 	enabled := parseEnvVarBool("GEMINI_AUTH_ENABLED", defaultAuthEnabled, logger)
-	secretKey := os.Getenv("GEMINI_AUTH_SECRET_KEY")
+	secretKey := getSetting("GEMINI_AUTH_SECRET_KEY")
+	jwksURL := strings.TrimSpace(getSetting("GEMINI_AUTH_JWKS_URL"))
 
-	if enabled && secretKey == "" {
-		return authConfig{}, fmt.Errorf("GEMINI_AUTH_SECRET_KEY is required when GEMINI_AUTH_ENABLED=true")
+	if jwksURL != "" {
+		u, err := url.Parse(jwksURL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return authConfig{}, fmt.Errorf("GEMINI_AUTH_JWKS_URL must be an absolute http(s) URL, got %q", jwksURL)
+		}
 	}
-	if enabled && len(secretKey) < 32 {
+	if enabled && secretKey == "" && jwksURL == "" {
+		return authConfig{}, fmt.Errorf("GEMINI_AUTH_SECRET_KEY or GEMINI_AUTH_JWKS_URL is required when GEMINI_AUTH_ENABLED=true")
+	}
+	if enabled && secretKey != "" && len(secretKey) < 32 {
 		return authConfig{}, fmt.Errorf("GEMINI_AUTH_SECRET_KEY must be at least 32 bytes for HS256 (got %d)", len(secretKey))
 	}
-	return authConfig{enabled: enabled, secretKey: secretKey}, nil
+	issuers := parseEnvVarList("GEMINI_AUTH_ISSUER")
+	if issuers == nil {
+		issuers = []string{defaultAuthIssuer}
+	}
+	audiences := parseEnvVarList("GEMINI_AUTH_AUDIENCE")
+	if audiences == nil {
+		audiences = []string{defaultAuthAudience}
+	}
+	return authConfig{enabled: enabled, secretKey: secretKey, jwksURL: jwksURL, issuers: issuers, audiences: audiences}, nil
 }
 
-// taskExecConfig captures task-augmented execution env values (concurrency +
-// pre-qualification classifier).
+// taskExecConfig captures task-augmented execution env values (concurrency,
+// pre-qualification classifier and empty-answer escalation).
 type taskExecConfig struct {
 	maxConcurrentTasks int
 	prequalify         bool
+	escalateOnEmpty    bool
+	escalationMap      map[string]string
 }
 
-func loadTaskConfig(logger Logger) taskExecConfig {
+func loadTaskConfig(logger Logger) (taskExecConfig, error) {
+	escalationMap, err := parseEscalationMap(getSetting("GEMINI_ESCALATION_MAP"))
+	if err != nil {
+		return taskExecConfig{}, err
+	}
 	return taskExecConfig{
 		maxConcurrentTasks: parseEnvVarInt("GEMINI_MAX_CONCURRENT_TASKS", defaultMaxConcurrentTasks, logger),
 		prequalify:         parseEnvVarBool("GEMINI_PREQUALIFY", defaultPrequalify, logger),
+		escalateOnEmpty:    parseEnvVarBool("GEMINI_ESCALATE_ON_EMPTY", defaultEscalateOnEmpty, logger),
+		escalationMap:      escalationMap,
+	}, nil
+}
+
+// parseEscalationMap parses GEMINI_ESCALATION_MAP, a comma-separated list of
+// from:to model pairs. Empty keeps defaultEscalationMap. Both models of a
+// pair must be on the same vendor's allowlist, because the escalator reuses
+// the answering provider's vendor and credentials.
+func parseEscalationMap(value string) (map[string]string, error) {
+	if strings.TrimSpace(value) == "" {
+		return maps.Clone(defaultEscalationMap), nil
+	}
+	m := map[string]string{}
+	for _, pair := range strings.Split(value, ",") {
+		from, to, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+		if !ok || from == "" || to == "" {
+			return nil, fmt.Errorf("GEMINI_ESCALATION_MAP: %q is not a from:to pair", pair)
+		}
+		if from == to {
+			return nil, fmt.Errorf("GEMINI_ESCALATION_MAP: %s escalates to itself", from)
+		}
+		if !sameVendorModels(from, to) {
+			return nil, fmt.Errorf("GEMINI_ESCALATION_MAP: %s and %s are not supported models of the same vendor", from, to)
+		}
+		m[from] = to
+	}
+	return m, nil
+}
+
+// sameVendorModels reports whether a and b are both on one vendor's allowlist.
+func sameVendorModels(a, b string) bool {
+	for _, models := range [][]string{deepseekModels, qwenModels} {
+		if slices.Contains(models, a) && slices.Contains(models, b) {
+			return true
+		}
 	}
+	return false
+}
+
+// registrationConfig captures which tools and prompts are exposed to
+// clients. A nil list means "register everything".
+type registrationConfig struct {
+	enabledTools   []string
+	enabledPrompts []string
+}
+
+func loadRegistrationConfig() registrationConfig {
+	return registrationConfig{
+		enabledTools:   parseEnvVarList("GEMINI_ENABLED_TOOLS"),
+		enabledPrompts: parseEnvVarList("GEMINI_ENABLED_PROMPTS"),
+	}
+}
+
+// responseSettings captures env values that shape the tool result returned to
+// clients.
+type responseSettings struct {
+	template       *template.Template
+	appendMetadata bool
+	envelope       bool
+}
+
+func loadResponseConfig(logger Logger) responseSettings {
+	rs := responseSettings{
+		appendMetadata: parseEnvVarBool("GEMINI_APPEND_METADATA", defaultAppendMetadata, logger),
+		envelope:       parseEnvVarBool("GEMINI_RESPONSE_ENVELOPE", defaultResponseEnvelope, logger),
+	}
+	if raw := getSetting("GEMINI_RESPONSE_TEMPLATE"); raw != "" {
+		tmpl, err := template.New("response").Option("missingkey=error").Parse(raw)
+		if err != nil {
+			logger.Warn("GEMINI_RESPONSE_TEMPLATE is invalid, returning answers unchanged: %v", err)
+		} else {
+			rs.template = tmpl
+		}
+	}
+	return rs
+}
+
+// traceSettings captures the offline-evaluation trace env values.
+type traceSettings struct {
+	dir          string
+	fileContents bool
+}
+
+func loadTraceConfig(logger Logger) traceSettings {
+	return traceSettings{
+		dir:          strings.TrimSpace(getSetting("GEMINI_TRACE_DIR")),
+		fileContents: parseEnvVarBool("GEMINI_TRACE_FILE_CONTENTS", defaultTraceFileContents, logger),
+	}
+}
+
+// policySettings captures operator-defined request policy env values.
+type policySettings struct {
+	queryDenyPatterns []*regexp.Regexp
+}
+
+// loadPolicyConfig compiles GEMINI_QUERY_DENY_PATTERNS. The value is either a
+// JSON array of regexes or a comma-separated list; an invalid regex fails
+// startup rather than silently disabling the policy.
+func loadPolicyConfig() (policySettings, error) {
+	raw := strings.TrimSpace(getSetting("GEMINI_QUERY_DENY_PATTERNS"))
+	if raw == "" {
+		return policySettings{}, nil
+	}
+	var exprs []string
+	if strings.HasPrefix(raw, "[") {
+		if err := json.Unmarshal([]byte(raw), &exprs); err != nil {
+			return policySettings{}, fmt.Errorf("GEMINI_QUERY_DENY_PATTERNS is not a valid JSON array: %w", err)
+		}
+	} else {
+		exprs = parseEnvVarList("GEMINI_QUERY_DENY_PATTERNS")
+	}
+	patterns := make([]*regexp.Regexp, 0, len(exprs))
+	for _, expr := range exprs {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return policySettings{}, fmt.Errorf("GEMINI_QUERY_DENY_PATTERNS: invalid regex %q: %w", expr, err)
+		}
+		patterns = append(patterns, re)
+	}
+	return policySettings{queryDenyPatterns: patterns}, nil
 }
 
 // githubSettings captures GitHub-integration env values.
 type githubSettings struct {
 	token                     string
 	apiBaseURL                string
+	rawHost                   string
+	defaultRepo               string
+	defaultRef                string
 	maxGitHubFiles            int
 	maxGitHubFileSize         int64
+	minFileSize               int64
+	maxGitHubTotalBytes       int64
 	maxGitHubDiffBytes        int64
 	maxGitHubCommits          int
+	maxGitHubTreeEntries      int
 	maxGitHubPRReviewComments int
+	autoIncludeReadme         bool
 }
 
 func loadGitHubConfig(logger Logger) githubSettings {
-	apiBaseURL := os.Getenv("GEMINI_GITHUB_API_BASE_URL")
+	apiBaseURL := getSetting("GEMINI_GITHUB_API_BASE_URL")
 	if apiBaseURL == "" {
 		apiBaseURL = defaultGitHubAPIBaseURL
 	}
@@ -278,6 +458,16 @@ func loadGitHubConfig(logger Logger) githubSettings {
 		logger.Warn("GEMINI_MAX_GITHUB_FILE_SIZE must be positive. Using default: %d", defaultMaxGitHubFileSize)
 		maxFileSize = defaultMaxGitHubFileSize
 	}
+	minFileSize := int64(parseEnvVarInt("GEMINI_MIN_FILE_SIZE", int(defaultMinFileSize), logger))
+	if minFileSize < 0 {
+		logger.Warn("GEMINI_MIN_FILE_SIZE must be non-negative. Using default: %d", defaultMinFileSize)
+		minFileSize = defaultMinFileSize
+	}
+	maxTotalBytes := int64(parseEnvVarInt("GEMINI_MAX_GITHUB_TOTAL_BYTES", int(defaultMaxGitHubTotalBytes), logger))
+	if maxTotalBytes < 0 {
+		logger.Warn("GEMINI_MAX_GITHUB_TOTAL_BYTES must be non-negative. Using default: %d", defaultMaxGitHubTotalBytes)
+		maxTotalBytes = defaultMaxGitHubTotalBytes
+	}
 	maxDiffBytes := int64(parseEnvVarInt("GEMINI_MAX_GITHUB_DIFF_BYTES", int(defaultMaxGitHubDiffBytes), logger))
 	if maxDiffBytes <= 0 {
 		logger.Warn("GEMINI_MAX_GITHUB_DIFF_BYTES must be positive. Using default: %d", defaultMaxGitHubDiffBytes)
@@ -288,20 +478,40 @@ func loadGitHubConfig(logger Logger) githubSettings {
 		logger.Warn("GEMINI_MAX_GITHUB_COMMITS must be positive. Using default: %d", defaultMaxGitHubCommits)
 		maxCommits = defaultMaxGitHubCommits
 	}
+	maxTreeEntries := parseEnvVarInt("GEMINI_MAX_GITHUB_TREE_ENTRIES", defaultMaxGitHubTreeEntries, logger)
+	if maxTreeEntries <= 0 {
+		logger.Warn("GEMINI_MAX_GITHUB_TREE_ENTRIES must be positive. Using default: %d", defaultMaxGitHubTreeEntries)
+		maxTreeEntries = defaultMaxGitHubTreeEntries
+	}
 	maxPRReviewComments := parseEnvVarInt("GEMINI_MAX_GITHUB_PR_REVIEW_COMMENTS", defaultMaxGitHubPRReviewComments, logger)
 	if maxPRReviewComments < 0 {
 		logger.Warn("GEMINI_MAX_GITHUB_PR_REVIEW_COMMENTS must be non-negative. Using default: %d", defaultMaxGitHubPRReviewComments)
 		maxPRReviewComments = defaultMaxGitHubPRReviewComments
 	}
 
+	defaultRepo := strings.TrimSpace(getSetting("GEMINI_DEFAULT_GITHUB_REPO"))
+	if defaultRepo != "" {
+		if _, _, err := parseGitHubRepo(defaultRepo); err != nil {
+			logger.Warn("GEMINI_DEFAULT_GITHUB_REPO ignored: %v", err)
+			defaultRepo = ""
+		}
+	}
+
 	return githubSettings{
-		token:                     os.Getenv("GEMINI_GITHUB_TOKEN"),
+		token:                     getSetting("GEMINI_GITHUB_TOKEN"),
 		apiBaseURL:                apiBaseURL,
+		rawHost:                   strings.TrimRight(getSetting("GEMINI_GITHUB_RAW_HOST"), "/"),
+		defaultRepo:               defaultRepo,
+		defaultRef:                strings.TrimSpace(getSetting("GEMINI_DEFAULT_GITHUB_REF")),
 		maxGitHubFiles:            maxFiles,
 		maxGitHubFileSize:         maxFileSize,
+		minFileSize:               minFileSize,
+		maxGitHubTotalBytes:       maxTotalBytes,
 		maxGitHubDiffBytes:        maxDiffBytes,
 		maxGitHubCommits:          maxCommits,
+		maxGitHubTreeEntries:      maxTreeEntries,
 		maxGitHubPRReviewComments: maxPRReviewComments,
+		autoIncludeReadme:         parseEnvVarBool("GEMINI_AUTO_INCLUDE_README", false, logger),
 	}
 }
 
@@ -343,18 +553,32 @@ func validateAuthInterop(auth authConfig, httpCfg httpTransportConfig) error {
 
 // NewConfig creates a new configuration from environment variables
 func NewConfig(logger Logger) (*Config, error) {
+	fileValues, err := loadConfigFile(os.Getenv("GEMINI_CONFIG_FILE"), logger)
+	setConfigFileValues(fileValues)
+	if err != nil {
+		return nil, err
+	}
 	provider, err := loadProviderConfig(logger)
 	if err != nil {
 		return nil, err
 	}
+	failover, err := loadFailoverProviderConfig()
+	if err != nil {
+		return nil, err
+	}
 	geminiTemperature := parseEnvVarFloat("GEMINI_TEMPERATURE", defaultGeminiTemperature, logger)
-	if geminiTemperature < 0.0 || geminiTemperature > 1.0 {
-		return nil, fmt.Errorf("GEMINI_TEMPERATURE must be between 0.0 and 1.0, got %v", geminiTemperature)
+	if geminiTemperature < 0.0 || geminiTemperature > maxGeminiTemperature {
+		return nil, fmt.Errorf("GEMINI_TEMPERATURE must be between 0.0 and %.1f, got %v", maxGeminiTemperature, geminiTemperature)
 	}
 
 	tr := loadTimeoutAndRetryConfig(logger)
 	github := loadGitHubConfig(logger)
-	task := loadTaskConfig(logger)
+	task, err := loadTaskConfig(logger)
+	if err != nil {
+		return nil, err
+	}
+	registration := loadRegistrationConfig()
+	response := loadResponseConfig(logger)
 	providerMaxTokens := parseEnvVarInt("PROVIDER_MAX_TOKENS", 0, logger)
 	if providerMaxTokens < 0 {
 		logger.Warn("PROVIDER_MAX_TOKENS must be non-negative. Using default: 0")
@@ -371,40 +595,161 @@ func NewConfig(logger Logger) (*Config, error) {
 	if err := validateAuthInterop(auth, httpCfg); err != nil {
 		return nil, err
 	}
-	return assembleConfig(provider, geminiTemperature, int32(providerMaxTokens), tr, github, task, httpCfg, auth), nil
+	policy, err := loadPolicyConfig()
+	if err != nil {
+		return nil, err
+	}
+	trace := loadTraceConfig(logger)
+	return assembleConfig(provider, failover, geminiTemperature, int32(providerMaxTokens), tr, github, task, registration, response, policy, trace, httpCfg, auth), nil
+}
+
+// loadConfigFile reads GEMINI_CONFIG_FILE before the settings are parsed.
+// The file is a flat JSON or YAML object (chosen by extension) whose keys are
+// the environment variable names documented in .env.example, e.g.
+//
+//	PROVIDER: deepseek
+//	GEMINI_TEMPERATURE: 0.7
+//
+// It returns the file's settings as strings for setConfigFileValues; the
+// process environment is never modified, and getSetting lets a variable that
+// is set in the environment override the file. Only this server's settings (see
+// configFileKeyAllowed) are kept; other keys are logged and ignored. A null
+// value leaves the setting unset.
+func loadConfigFile(path string, logger Logger) (map[string]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("GEMINI_CONFIG_FILE: %w", err)
+	}
+	values := map[string]any{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		err = dec.Decode(&values)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &values)
+	default:
+		return nil, fmt.Errorf("GEMINI_CONFIG_FILE %s: unsupported extension %q; use .json, .yaml or .yml", path, ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("GEMINI_CONFIG_FILE %s is malformed: %w", path, err)
+	}
+	settings := make(map[string]string, len(values))
+	for key, raw := range values {
+		if !configFileKeyAllowed(key) {
+			logger.Warn("GEMINI_CONFIG_FILE %s: ignoring %s; only GEMINI_*, PROVIDER* and FAILOVER_PROVIDER* settings are read", path, key)
+			continue
+		}
+		var value string
+		switch v := raw.(type) {
+		case nil:
+			continue
+		case string:
+			value = v
+		case json.Number:
+			value = v.String()
+		case bool, int, int64, uint64:
+			value = fmt.Sprint(v)
+		case float64:
+			value = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			return nil, fmt.Errorf("GEMINI_CONFIG_FILE %s: %s must be a string, number or boolean", path, key)
+		}
+		settings[key] = value
+	}
+	return settings, nil
+}
+
+// configFileValues holds the settings from the most recent GEMINI_CONFIG_FILE
+// load. NewConfig replaces them on every call, so a corrected file takes
+// effect on the next load (e.g. GEMINI_STARTUP_RETRY_INTERVAL retries).
+var configFileValues struct {
+	sync.RWMutex
+	values map[string]string
+}
+
+func setConfigFileValues(values map[string]string) {
+	configFileValues.Lock()
+	defer configFileValues.Unlock()
+	configFileValues.values = values
+}
+
+// getSetting returns the value of a configuration variable: the environment
+// when it is set, else the GEMINI_CONFIG_FILE value, else "".
+func getSetting(key string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	configFileValues.RLock()
+	defer configFileValues.RUnlock()
+	return configFileValues.values[key]
+}
+
+// configFileKeyAllowed reports whether key is one of this server's settings:
+// GEMINI_*, PROVIDER and PROVIDER_*, FAILOVER_PROVIDER and FAILOVER_PROVIDER_*.
+func configFileKeyAllowed(key string) bool {
+	for _, prefix := range []string{"PROVIDER", "FAILOVER_PROVIDER"} {
+		if key == prefix || strings.HasPrefix(key, prefix+"_") {
+			return true
+		}
+	}
+	return strings.HasPrefix(key, "GEMINI_")
 }
 
 // loadProviderConfig parses and validates the provider-specific environment.
 func loadProviderConfig(_ Logger) (ProviderConfig, error) {
-	vendor := strings.ToLower(strings.TrimSpace(os.Getenv("PROVIDER")))
+	return loadProviderEnv("PROVIDER")
+}
+
+// loadFailoverProviderConfig parses the optional secondary backend from the
+// FAILOVER_PROVIDER* variables, which mirror PROVIDER*. It returns nil when
+// FAILOVER_PROVIDER is unset.
+func loadFailoverProviderConfig() (*ProviderConfig, error) {
+	if strings.TrimSpace(getSetting("FAILOVER_PROVIDER")) == "" {
+		return nil, nil
+	}
+	cfg, err := loadProviderEnv("FAILOVER_PROVIDER")
+	if err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// loadProviderEnv reads <prefix>, <prefix>_API_KEY, <prefix>_BASE_URL and
+// <prefix>_MODEL and validates them for the selected vendor.
+func loadProviderEnv(prefix string) (ProviderConfig, error) {
+	vendor := strings.ToLower(strings.TrimSpace(getSetting(prefix)))
 	if vendor == "" {
-		return ProviderConfig{}, errors.New("PROVIDER environment variable is required (deepseek or qwen)")
+		return ProviderConfig{}, fmt.Errorf("%s environment variable is required (deepseek or qwen)", prefix)
 	}
-	providerAPIKey := os.Getenv("PROVIDER_API_KEY")
-	providerBaseURL := os.Getenv("PROVIDER_BASE_URL")
-	providerModel := os.Getenv("PROVIDER_MODEL")
+	providerAPIKey := getSetting(prefix + "_API_KEY")
+	providerBaseURL := getSetting(prefix + "_BASE_URL")
+	providerModel := getSetting(prefix + "_MODEL")
 
 	switch vendor {
 	case "deepseek":
-		return loadDeepSeekProviderConfig(providerAPIKey, providerBaseURL, providerModel)
+		return loadDeepSeekProviderConfig(prefix, providerAPIKey, providerBaseURL, providerModel)
 	case "qwen":
-		return loadQwenProviderConfig(providerAPIKey, providerBaseURL, providerModel)
+		return loadQwenProviderConfig(prefix, providerAPIKey, providerBaseURL, providerModel)
 	default:
-		return ProviderConfig{}, fmt.Errorf("unsupported PROVIDER value %q; valid values: deepseek, qwen", vendor)
+		return ProviderConfig{}, fmt.Errorf("unsupported %s value %q; valid values: deepseek, qwen", prefix, vendor)
 	}
 }
 
 // loadDeepSeekProviderConfig validates DeepSeek settings and applies its base
 // URL default.
-func loadDeepSeekProviderConfig(apiKey, baseURL, model string) (ProviderConfig, error) {
+func loadDeepSeekProviderConfig(prefix, apiKey, baseURL, model string) (ProviderConfig, error) {
 	if apiKey == "" {
-		return ProviderConfig{}, errors.New("PROVIDER_API_KEY environment variable is required when PROVIDER=deepseek")
+		return ProviderConfig{}, fmt.Errorf("%s_API_KEY environment variable is required when %s=deepseek", prefix, prefix)
 	}
 	if model == "" {
-		return ProviderConfig{}, errors.New("PROVIDER_MODEL environment variable is required when PROVIDER=deepseek")
+		return ProviderConfig{}, fmt.Errorf("%s_MODEL environment variable is required when %s=deepseek", prefix, prefix)
 	}
 	if !slices.Contains(deepseekModels, model) {
-		return ProviderConfig{}, fmt.Errorf("PROVIDER_MODEL %q is unsupported for deepseek; allowed values: %s", model,
+		return ProviderConfig{}, fmt.Errorf("%s_MODEL %q is unsupported for deepseek; allowed values: %s", prefix, model,
 			strings.Join(deepseekModels, ", "))
 	}
 	if baseURL == "" {
@@ -414,22 +759,22 @@ func loadDeepSeekProviderConfig(apiKey, baseURL, model string) (ProviderConfig,
 }
 
 // loadQwenProviderConfig validates Qwen settings. Its endpoint is deployment
-// specific, so PROVIDER_BASE_URL has no global default.
-func loadQwenProviderConfig(apiKey, baseURL, model string) (ProviderConfig, error) {
+// specific, so <prefix>_BASE_URL has no global default.
+func loadQwenProviderConfig(prefix, apiKey, baseURL, model string) (ProviderConfig, error) {
 	if apiKey == "" {
-		return ProviderConfig{}, errors.New("PROVIDER_API_KEY environment variable is required when PROVIDER=qwen")
+		return ProviderConfig{}, fmt.Errorf("%s_API_KEY environment variable is required when %s=qwen", prefix, prefix)
 	}
 	if model == "" {
-		return ProviderConfig{}, errors.New("PROVIDER_MODEL environment variable is required when PROVIDER=qwen")
+		return ProviderConfig{}, fmt.Errorf("%s_MODEL environment variable is required when %s=qwen", prefix, prefix)
 	}
 	if !slices.Contains(qwenModels, model) {
-		return ProviderConfig{}, fmt.Errorf("PROVIDER_MODEL %q is unsupported for qwen; allowed values: %s", model,
+		return ProviderConfig{}, fmt.Errorf("%s_MODEL %q is unsupported for qwen; allowed values: %s", prefix, model,
 			strings.Join(qwenModels, ", "))
 	}
 	if baseURL == "" {
-		return ProviderConfig{}, errors.New(
-			"PROVIDER_BASE_URL is required when PROVIDER=qwen; set it to your DashScope-compatible endpoint " +
-				"(e.g. https://dashscope-intl.aliyuncs.com/compatible-mode/v1)",
+		return ProviderConfig{}, fmt.Errorf(
+			"%s_BASE_URL is required when %s=qwen; set it to your DashScope-compatible endpoint "+
+				"(e.g. https://dashscope-intl.aliyuncs.com/compatible-mode/v1)", prefix, prefix,
 		)
 	}
 	return ProviderConfig{Vendor: "qwen", APIKey: apiKey, BaseURL: baseURL, Model: model}, nil
@@ -440,16 +785,22 @@ func loadQwenProviderConfig(apiKey, baseURL, model string) (ProviderConfig, erro
 // and cross-section validation.
 func assembleConfig(
 	provider ProviderConfig,
+	failover *ProviderConfig,
 	geminiTemperature float64,
 	providerMaxTokens int32,
 	tr timeoutAndRetryConfig,
 	github githubSettings,
 	task taskExecConfig,
+	registration registrationConfig,
+	response responseSettings,
+	policy policySettings,
+	trace traceSettings,
 	httpCfg httpTransportConfig,
 	auth authConfig,
 ) *Config {
 	return &Config{
 		Provider:                       provider,
+		FailoverProvider:               failover,
 		GeminiTemperature:              geminiTemperature,
 		ProviderMaxTokens:              providerMaxTokens,
 		HTTPTimeout:                    tr.timeout,
@@ -468,18 +819,42 @@ func assembleConfig(
 
 		AuthEnabled:    auth.enabled,
 		AuthSecretKey:  auth.secretKey,
+		AuthJWKSURL:    auth.jwksURL,
+		AuthIssuers:    auth.issuers,
+		AuthAudiences:  auth.audiences,
 		MaxRetries:     tr.maxRetries,
 		InitialBackoff: tr.initialBackoff,
 		MaxBackoff:     tr.maxBackoff,
 
 		GitHubToken:               github.token,
 		GitHubAPIBaseURL:          github.apiBaseURL,
+		GitHubRawHost:             github.rawHost,
+		DefaultGitHubRepo:         github.defaultRepo,
+		DefaultGitHubRef:          github.defaultRef,
 		MaxGitHubFiles:            github.maxGitHubFiles,
 		MaxGitHubFileSize:         github.maxGitHubFileSize,
+		MinFileSize:               github.minFileSize,
+		MaxGitHubTotalBytes:       github.maxGitHubTotalBytes,
 		MaxGitHubDiffBytes:        github.maxGitHubDiffBytes,
 		MaxGitHubCommits:          github.maxGitHubCommits,
+		MaxGitHubTreeEntries:      github.maxGitHubTreeEntries,
 		MaxGitHubPRReviewComments: github.maxGitHubPRReviewComments,
+		AutoIncludeReadme:         github.autoIncludeReadme,
+
+		Prequalify:      task.prequalify,
+		EscalateOnEmpty: task.escalateOnEmpty,
+		EscalationMap:   task.escalationMap,
+
+		EnabledTools:   registration.enabledTools,
+		EnabledPrompts: registration.enabledPrompts,
+
+		ResponseTemplate: response.template,
+		AppendMetadata:   response.appendMetadata,
+		ResponseEnvelope: response.envelope,
+
+		QueryDenyPatterns: policy.queryDenyPatterns,
 
-		Prequalify: task.prequalify,
+		TraceDir:          trace.dir,
+		TraceFileContents: trace.fileContents,
 	}
 }
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -110,6 +112,56 @@ func TestNewConfigProviderMaxTokens(t *testing.T) {
 	}
 }
 
+func TestNewConfigTemperatureRange(t *testing.T) {
+	tests := []struct {
+		name, value string
+		want        float64
+		wantErr     bool
+	}{{"default", "", 1.0, false}, {"above one", "1.8", 1.8, false}, {"ceiling", "2.0", 2.0, false}, {"too high", "2.5", 0, true}, {"negative", "-0.1", 0, true}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withCleanEnv(t)
+			setupEnv(t, map[string]string{"PROVIDER": "deepseek", "PROVIDER_API_KEY": "key", "PROVIDER_MODEL": "deepseek-v4-pro", "GEMINI_TEMPERATURE": tt.value})
+			cfg, err := NewConfig(NewLogger(LevelError))
+			if tt.wantErr {
+				assert.ErrorContains(t, err, "GEMINI_TEMPERATURE must be between 0.0 and 2.0")
+				return
+			}
+			require.NoError(t, err)
+			assert.InDelta(t, tt.want, cfg.GeminiTemperature, 1e-9)
+		})
+	}
+}
+
+func TestNewConfigEscalationMap(t *testing.T) {
+	tests := []struct {
+		name, value string
+		want        map[string]string
+		wantErr     string
+	}{
+		{"default", "", defaultEscalationMap, ""},
+		{"custom", " qwen3.7-max : qwen3.8-max-preview , deepseek-v4-flash:deepseek-v4-pro",
+			map[string]string{"qwen3.7-max": "qwen3.8-max-preview", "deepseek-v4-flash": "deepseek-v4-pro"}, ""},
+		{"missing target", "deepseek-v4-flash", nil, "not a from:to pair"},
+		{"cross vendor", "deepseek-v4-flash:qwen3.7-max", nil, "not supported models of the same vendor"},
+		{"unknown model", "deepseek-v4-flash:deepseek-v5", nil, "not supported models of the same vendor"},
+		{"self", "qwen3.7-max:qwen3.7-max", nil, "escalates to itself"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withCleanEnv(t)
+			setupEnv(t, map[string]string{"PROVIDER": "deepseek", "PROVIDER_API_KEY": "key", "PROVIDER_MODEL": "deepseek-v4-pro", "GEMINI_ESCALATION_MAP": tt.value})
+			cfg, err := NewConfig(NewLogger(LevelError))
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, cfg.EscalationMap)
+		})
+	}
+}
+
 func TestConfigActiveModel(t *testing.T) {
 	tests := []struct {
 		name string
@@ -123,3 +175,172 @@ func TestConfigActiveModel(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) { assert.Equal(t, tt.want, tt.cfg.ActiveModel()) })
 	}
 }
+
+func TestNewConfigEnabledLists(t *testing.T) {
+	withCleanEnv(t)
+	setupEnv(t, map[string]string{
+		"PROVIDER": "deepseek", "PROVIDER_API_KEY": "key", "PROVIDER_MODEL": "deepseek-v4-pro",
+		"GEMINI_ENABLED_TOOLS": " gemini_ask ,", "GEMINI_ENABLED_PROMPTS": "code_review, review_pr",
+	})
+	cfg, err := NewConfig(NewLogger(LevelError))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"gemini_ask"}, cfg.EnabledTools)
+	assert.Equal(t, []string{"code_review", "review_pr"}, cfg.EnabledPrompts)
+}
+
+func TestNewConfigResponseTemplate(t *testing.T) {
+	for _, tt := range []struct {
+		name, value string
+		wantSet     bool
+	}{{"unset", "", false}, {"valid", "{{.Answer}}", true}, {"invalid falls back", "{{.Answer", false}} {
+		t.Run(tt.name, func(t *testing.T) {
+			withCleanEnv(t)
+			setupEnv(t, map[string]string{"PROVIDER": "deepseek", "PROVIDER_API_KEY": "key", "PROVIDER_MODEL": "deepseek-v4-pro", "GEMINI_RESPONSE_TEMPLATE": tt.value})
+			cfg, err := NewConfig(NewLogger(LevelError))
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantSet, cfg.ResponseTemplate != nil)
+		})
+	}
+}
+
+func TestNewConfigQueryDenyPatterns(t *testing.T) {
+	for _, tt := range []struct {
+		name, value string
+		want        int
+		wantErr     string
+	}{
+		{"unset", "", 0, ""},
+		{"comma list", `(?i)api[_-]?key, BEGIN RSA`, 2, ""},
+		{"json array keeps commas", `["a{1,3}b", "secret"]`, 2, ""},
+		{"invalid regex", `(unclosed`, 0, "invalid regex"},
+		{"invalid json", `["a"`, 0, "JSON array"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			withCleanEnv(t)
+			setupEnv(t, map[string]string{"PROVIDER": "deepseek", "PROVIDER_API_KEY": "key", "PROVIDER_MODEL": "deepseek-v4-pro", "GEMINI_QUERY_DENY_PATTERNS": tt.value})
+			cfg, err := NewConfig(NewLogger(LevelError))
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, cfg.QueryDenyPatterns, tt.want)
+		})
+	}
+}
+
+func TestNewConfigFile(t *testing.T) {
+	for _, tt := range []struct {
+		name, file, content string
+		env                 map[string]string
+		wantTemp            float64
+		wantFiles           int
+		wantErr             string
+	}{
+		{"yaml values applied", "cfg.yaml", "PROVIDER: deepseek\nPROVIDER_API_KEY: key\nPROVIDER_MODEL: deepseek-v4-pro\nGEMINI_TEMPERATURE: 0.5\nGEMINI_MAX_GITHUB_FILES: 5\n", nil, 0.5, 5, ""},
+		{"json values applied", "cfg.json", `{"PROVIDER": "deepseek", "PROVIDER_API_KEY": "key", "PROVIDER_MODEL": "deepseek-v4-pro", "GEMINI_TEMPERATURE": 0.25, "GEMINI_MAX_GITHUB_FILES": 1000000}`, nil, 0.25, 1000000, ""},
+		{"env overrides file", "cfg.yml", "PROVIDER: deepseek\nPROVIDER_API_KEY: key\nPROVIDER_MODEL: deepseek-v4-pro\nGEMINI_TEMPERATURE: 0.5\n", map[string]string{"GEMINI_TEMPERATURE": "0.9"}, 0.9, defaultMaxGitHubFiles, ""},
+		{"merged values validated", "cfg.yaml", "PROVIDER: deepseek\nPROVIDER_API_KEY: key\nPROVIDER_MODEL: deepseek-v4-pro\nGEMINI_TEMPERATURE: 3\n", nil, 0, 0, "GEMINI_TEMPERATURE must be between"},
+		{"malformed json", "cfg.json", `{"PROVIDER": `, nil, 0, 0, "is malformed"},
+		{"malformed yaml", "cfg.yaml", "PROVIDER: [deepseek\n", nil, 0, 0, "is malformed"},
+		{"null value left unset", "cfg.yaml", "PROVIDER: deepseek\nPROVIDER_API_KEY: key\nPROVIDER_MODEL: deepseek-v4-pro\nGEMINI_TEMPERATURE: null\n", nil, defaultGeminiTemperature, defaultMaxGitHubFiles, ""},
+		{"uint64 value validated", "cfg.yaml", "PROVIDER: deepseek\nPROVIDER_API_KEY: key\nPROVIDER_MODEL: deepseek-v4-pro\nGEMINI_MAX_GITHUB_FILES: 18446744073709551615\n", nil, defaultGeminiTemperature, defaultMaxGitHubFiles, ""},
+		{"nested value", "cfg.yaml", "PROVIDER:\n  name: deepseek\n", nil, 0, 0, "PROVIDER must be a string, number or boolean"},
+		{"unsupported extension", "cfg.toml", "PROVIDER = 'deepseek'", nil, 0, 0, "unsupported extension"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			withCleanEnv(t)
+			path := filepath.Join(t.TempDir(), tt.file)
+			require.NoError(t, os.WriteFile(path, []byte(tt.content), 0o600))
+			setupEnv(t, tt.env)
+			t.Setenv("GEMINI_CONFIG_FILE", path)
+			cfg, err := NewConfig(NewLogger(LevelError))
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "deepseek", cfg.Provider.Vendor)
+			assert.InDelta(t, tt.wantTemp, cfg.GeminiTemperature, 1e-9)
+			assert.Equal(t, tt.wantFiles, cfg.MaxGitHubFiles)
+		})
+	}
+
+	t.Run("unknown keys ignored", func(t *testing.T) {
+		withCleanEnv(t)
+		path := filepath.Join(t.TempDir(), "cfg.yaml")
+		content := "PROVIDER: deepseek\nPROVIDER_API_KEY: key\nPROVIDER_MODEL: deepseek-v4-pro\nPATH: /tmp/evil\nPROVIDERX: 1\n"
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		t.Setenv("GEMINI_CONFIG_FILE", path)
+		_, err := NewConfig(NewLogger(LevelError))
+		require.NoError(t, err)
+		_, set := os.LookupEnv("PATH")
+		assert.False(t, set)
+		_, set = os.LookupEnv("PROVIDERX")
+		assert.False(t, set)
+	})
+
+	t.Run("reload picks up file changes", func(t *testing.T) {
+		withCleanEnv(t)
+		path := filepath.Join(t.TempDir(), "cfg.yaml")
+		write := func(temp string) {
+			content := "PROVIDER: deepseek\nPROVIDER_API_KEY: key\nPROVIDER_MODEL: deepseek-v4-pro\nGEMINI_TEMPERATURE: " + temp + "\n"
+			require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		}
+		t.Setenv("GEMINI_CONFIG_FILE", path)
+		write("0.5")
+		cfg, err := NewConfig(NewLogger(LevelError))
+		require.NoError(t, err)
+		assert.InDelta(t, 0.5, cfg.GeminiTemperature, 1e-9)
+		_, set := os.LookupEnv("GEMINI_TEMPERATURE")
+		assert.False(t, set, "file values must not leak into the environment")
+
+		write("0.7")
+		cfg, err = NewConfig(NewLogger(LevelError))
+		require.NoError(t, err)
+		assert.InDelta(t, 0.7, cfg.GeminiTemperature, 1e-9)
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		withCleanEnv(t)
+		t.Setenv("GEMINI_CONFIG_FILE", filepath.Join(t.TempDir(), "absent.yaml"))
+		_, err := NewConfig(NewLogger(LevelError))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "GEMINI_CONFIG_FILE")
+	})
+}
+
+func TestNewConfigFailoverProvider(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		env     map[string]string
+		want    *ProviderConfig
+		wantErr string
+	}{
+		{"unset", nil, nil, ""},
+		{
+			"qwen failover",
+			map[string]string{"FAILOVER_PROVIDER": "qwen", "FAILOVER_PROVIDER_API_KEY": "key2", "FAILOVER_PROVIDER_MODEL": "qwen3.7-max", "FAILOVER_PROVIDER_BASE_URL": "https://qwen.example"},
+			&ProviderConfig{Vendor: "qwen", APIKey: "key2", BaseURL: "https://qwen.example", Model: "qwen3.7-max"},
+			"",
+		},
+		{"missing key", map[string]string{"FAILOVER_PROVIDER": "deepseek", "FAILOVER_PROVIDER_MODEL": "deepseek-v4-flash"}, nil, "FAILOVER_PROVIDER_API_KEY environment variable is required"},
+		{"unknown vendor", map[string]string{"FAILOVER_PROVIDER": "gemini"}, nil, "unsupported FAILOVER_PROVIDER value"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			withCleanEnv(t)
+			setupEnv(t, map[string]string{"PROVIDER": "deepseek", "PROVIDER_API_KEY": "key", "PROVIDER_MODEL": "deepseek-v4-pro"})
+			setupEnv(t, tt.env)
+			cfg, err := NewConfig(NewLogger(LevelError))
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, cfg.FailoverProvider)
+		})
+	}
+}
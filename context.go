@@ -25,4 +25,8 @@ const (
 	httpPathKey contextKey = "http_path"
 	// httpRemoteAddrKey is the context key for HTTP remote address
 	httpRemoteAddrKey contextKey = "http_remote_addr"
+	// githubTokenKey is the context key for a per-request GitHub token
+	githubTokenKey contextKey = "github_token"
+	// requestTimingKey is the context key for the gemini_ask phase timer
+	requestTimingKey contextKey = "request_timing"
 )
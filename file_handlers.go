@@ -10,6 +10,7 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -115,9 +116,16 @@ func fetchFromGitHub(ctx context.Context, s *GeminiServer, repoURL, ref string,
 	}
 
 	logger.Info("GitHub API configuration - Base URL: %s", s.config.GitHubAPIBaseURL)
-	logger.Info("GitHub API configuration - Token available: %t", s.config.GitHubToken != "")
+	logger.Info("GitHub API configuration - Token available: %t", s.githubToken(ctx) != "")
 	logger.Info("GitHub API configuration - Max file size: %d bytes", s.config.MaxGitHubFileSize)
 
+	// fetchCtx lets the GEMINI_MAX_GITHUB_TOTAL_BYTES check abort the
+	// remaining fetches as soon as the aggregate cap is crossed.
+	fetchCtx, cancelFetch := context.WithCancel(ctx)
+	defer cancelFetch()
+	var totalBytes atomic.Int64
+	var capExceeded atomic.Bool
+
 	var wg sync.WaitGroup
 	errChannel := make(chan error, len(files))
 	uploadsChan := make(chan *FileUploadRequest, len(files))
@@ -131,12 +139,29 @@ func fetchFromGitHub(ctx context.Context, s *GeminiServer, repoURL, ref string,
 		wg.Add(1)
 		go func(filePath string) {
 			defer wg.Done()
-			semaphore <- struct{}{}
+			// Waiting for a slot must not outlive the request: once ctx is
+			// cancelled, queued files fail immediately instead of starting.
+			// In-flight fetches abort on their own because the request (and
+			// therefore the body read) is bound to ctx.
+			select {
+			case semaphore <- struct{}{}:
+			case <-fetchCtx.Done():
+				errChannel <- &fileFetchError{path: filePath, err: fetchCtx.Err()}
+				return
+			}
 			defer func() { <-semaphore }()
 
-			upload, err := fetchSingleFile(ctx, s, s.httpClient, owner, repo, filePath, ref)
+			upload, err := fetchSingleFile(fetchCtx, s, s.httpClient, owner, repo, filePath, ref)
 			if err != nil {
-				errChannel <- err
+				errChannel <- &fileFetchError{path: filePath, err: err}
+				return
+			}
+			if upload == nil {
+				return
+			}
+			if limit := s.config.MaxGitHubTotalBytes; limit > 0 && totalBytes.Add(int64(len(upload.Content))) > limit {
+				capExceeded.Store(true)
+				cancelFetch()
 				return
 			}
 			uploadsChan <- upload
@@ -150,6 +175,14 @@ func fetchFromGitHub(ctx context.Context, s *GeminiServer, repoURL, ref string,
 
 	uploads, combinedErrs := drainResults(uploadsChan, errChannel)
 
+	if capExceeded.Load() {
+		logger.Error("GitHub files exceed the aggregate limit of %d bytes; fetch aborted", s.config.MaxGitHubTotalBytes)
+		return nil, []error{fmt.Errorf(
+			"requested github_files exceed the total size limit of %d bytes (GEMINI_MAX_GITHUB_TOTAL_BYTES); request fewer or smaller files",
+			s.config.MaxGitHubTotalBytes,
+		)}
+	}
+
 	// Sort uploads by filename to ensure deterministic ordering.
 	// Concurrent fetches return in completion order, but implicit caching
 	// requires a stable prefix across identical requests.
@@ -161,6 +194,17 @@ func fetchFromGitHub(ctx context.Context, s *GeminiServer, repoURL, ref string,
 	return uploads, combinedErrs
 }
 
+// fileFetchError ties a per-file fetch failure to the requested path so
+// callers can report which files were dropped and why. Error() is the
+// underlying message unchanged.
+type fileFetchError struct {
+	path string
+	err  error
+}
+
+func (e *fileFetchError) Error() string { return e.err.Error() }
+func (e *fileFetchError) Unwrap() error { return e.err }
+
 // rateLimitError carries a server-provided reset wait duration.
 // It implements RetryAfterError so withRetryClassified uses the hint.
 type rateLimitError struct {
@@ -291,8 +335,8 @@ func performFetchRequest(ctx context.Context, p fetchAttemptParams) (*http.Respo
 		return nil, fetchAttemptOutcome{fatalErr: fmt.Errorf("failed to create request for %s: %w", p.filePath, err)}
 	}
 	req.Header.Set("Accept", "application/vnd.github.v3.raw")
-	if p.s.config.GitHubToken != "" {
-		req.Header.Set("Authorization", "token "+p.s.config.GitHubToken)
+	if token := p.s.githubToken(ctx); token != "" {
+		req.Header.Set("Authorization", "token "+token)
 	}
 	resp, err := p.client.Do(req)
 	if err != nil {
@@ -371,7 +415,7 @@ func fetchAttempt(ctx context.Context, p fetchAttemptParams) fetchAttemptOutcome
 		bodyMsg := readErrorBody(resp, logger, p.filePath)
 		logger.Error("[%s] HTTP error %d: %s", p.filePath, resp.StatusCode, bodyMsg)
 
-		userErr, retryable := mapNonOKStatus(resp.StatusCode, p.owner, p.repo, p.filePath, p.ref, p.s.config.GitHubToken != "")
+		userErr, retryable := mapNonOKStatus(resp.StatusCode, p.owner, p.repo, p.filePath, p.ref, p.s.githubToken(ctx) != "")
 		if retryable {
 			return fetchAttemptOutcome{retryErr: userErr}
 		}
@@ -383,26 +427,48 @@ func fetchAttempt(ctx context.Context, p fetchAttemptParams) fetchAttemptOutcome
 
 // buildContentsAPIURL builds the raw-content endpoint URL for a file path.
 func buildContentsAPIURL(baseURL, owner, repo, filePath, ref string) string {
-	// URL-escape individual path segments to handle filenames with spaces or
-	// special chars, while preserving the directory separator slashes.
-	segments := strings.Split(filePath, "/")
-	for i, seg := range segments {
-		segments[i] = url.PathEscape(seg)
-	}
-	apiURL := fmt.Sprintf("%s/repos/%s/%s/contents/%s", baseURL, owner, repo, strings.Join(segments, "/"))
+	apiURL := fmt.Sprintf("%s/repos/%s/%s/contents/%s", baseURL, owner, repo, escapePathSegments(filePath))
 	if ref != "" {
 		apiURL += "?ref=" + url.QueryEscape(ref)
 	}
 	return apiURL
 }
 
+// buildRawContentURL builds the raw-host URL for a file path, e.g.
+// https://raw.githubusercontent.com/owner/repo/main/src/app.go. An empty ref
+// resolves to the default branch via HEAD.
+func buildRawContentURL(rawHost, owner, repo, filePath, ref string) string {
+	if ref == "" {
+		ref = "HEAD"
+	}
+	return fmt.Sprintf("%s/%s/%s/%s/%s", rawHost, owner, repo, escapePathSegments(ref), escapePathSegments(filePath))
+}
+
+// escapePathSegments URL-escapes each segment of p to handle names with
+// spaces or special chars, while preserving the separator slashes (which
+// also keeps branch names like feature/x intact on the raw host).
+func escapePathSegments(p string) string {
+	segments := strings.Split(p, "/")
+	for i, seg := range segments {
+		segments[i] = url.PathEscape(seg)
+	}
+	return strings.Join(segments, "/")
+}
+
 // fetchSingleFile fetches a single file from GitHub with retries and rate limit handling.
+// It returns (nil, nil) when the file is smaller than GEMINI_MIN_FILE_SIZE.
 func fetchSingleFile(ctx context.Context, s *GeminiServer, client *http.Client, owner, repo, filePath, ref string) (*FileUploadRequest, error) {
 	logger := getLoggerFromContext(ctx)
 	startTime := time.Now()
 	logger.Info("[%s] Starting fetch at %s", filePath, startTime.Format(time.RFC3339))
 
 	apiURL := buildContentsAPIURL(s.config.GitHubAPIBaseURL, owner, repo, filePath, ref)
+	// The raw host serves public files without the API's rate limit and
+	// size ceiling, but it cannot take the API token, so authenticated
+	// fetches (private repos) stay on the API.
+	if s.config.GitHubRawHost != "" && s.githubToken(ctx) == "" {
+		apiURL = buildRawContentURL(s.config.GitHubRawHost, owner, repo, filePath, ref)
+	}
 	logger.Info("[%s] Constructed API URL: %s", filePath, apiURL)
 
 	params := fetchAttemptParams{
@@ -438,7 +504,12 @@ func fetchSingleFile(ctx context.Context, s *GeminiServer, client *http.Client,
 		if errors.As(err, &nre) {
 			return nil, nre.Unwrap()
 		}
-		return nil, fmt.Errorf("failed to fetch %s: %v", filePath, err)
+		return nil, fmt.Errorf("failed to fetch %s: %w", filePath, err)
+	}
+	if int64(len(upload.Content)) < s.config.MinFileSize {
+		logger.Debug("[%s] Skipping file: %d bytes is below GEMINI_MIN_FILE_SIZE (%d)",
+			filePath, len(upload.Content), s.config.MinFileSize)
+		return nil, nil
 	}
 	return upload, nil
 }
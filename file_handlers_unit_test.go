@@ -4,8 +4,11 @@ import (
 	"context"
 	"io"
 	"net/http"
+	"net/http/httptest"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -100,3 +103,200 @@ func TestRateLimitResponseRetryAfterRemainingNonZeroIsRetryable(t *testing.T) {
 	assert.Nil(t, ctxErr)
 	assert.EqualError(t, retryErr, "rate limit exceeded")
 }
+
+func TestBuildContentsAPIURLEscapesSegments(t *testing.T) {
+	tests := []struct {
+		name, filePath, ref, want string
+	}{
+		{"plain", "src/main.go", "", "https://api.test/repos/o/r/contents/src/main.go"},
+		{"space", "docs/my file.go", "", "https://api.test/repos/o/r/contents/docs/my%20file.go"},
+		{"hash", "notes/#1.md", "", "https://api.test/repos/o/r/contents/notes/%231.md"},
+		{"unicode", "ファイル.go", "", "https://api.test/repos/o/r/contents/%E3%83%95%E3%82%A1%E3%82%A4%E3%83%AB.go"},
+		{"ref", "a.go", "feature/x y", "https://api.test/repos/o/r/contents/a.go?ref=feature%2Fx+y"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, buildContentsAPIURL("https://api.test", "o", "r", tt.filePath, tt.ref))
+		})
+	}
+}
+
+func TestNormalizeGitHubFilePaths(t *testing.T) {
+	assert.Equal(t, []string{"src/main.go", "a b.go", "docs/x.md"},
+		normalizeGitHubFilePaths([]string{"./src//main.go", " a b.go ", "docs/./x.md"}))
+	assert.Error(t, validateFilePathArray([]string{"./"}))
+}
+
+func TestFetchSingleFileEncodedPaths(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.EscapedPath() {
+		case "/repos/o/r/contents/my%20file.go",
+			"/repos/o/r/contents/notes/%231.md",
+			"/repos/o/r/contents/%E3%83%95%E3%82%A1%E3%82%A4%E3%83%AB.go":
+			_, _ = io.WriteString(w, "content of "+r.URL.Path)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	s := &GeminiServer{
+		config:     &Config{GitHubAPIBaseURL: server.URL, MaxGitHubFileSize: 1024, GitHubToken: "t"},
+		httpClient: &http.Client{Timeout: 5 * time.Second},
+	}
+	for _, filePath := range []string{"my file.go", "notes/#1.md", "ファイル.go"} {
+		t.Run(filePath, func(t *testing.T) {
+			upload, err := fetchSingleFile(context.Background(), s, s.httpClient, "o", "r", filePath, "")
+			require.NoError(t, err)
+			assert.Equal(t, filePath, upload.FileName)
+			assert.Equal(t, "content of /repos/o/r/contents/"+filePath, string(upload.Content))
+		})
+	}
+}
+
+func TestFetchFromGitHubMinFileSize(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/repos/o/r/contents/main.go" {
+			_, _ = io.WriteString(w, "package main")
+		}
+	}))
+	defer server.Close()
+
+	for _, tt := range []struct {
+		name    string
+		minSize int64
+		want    []string
+	}{
+		{"disabled keeps empty file", 0, []string{"main.go", "pkg/__init__.py"}},
+		{"zero-byte file skipped", 1, []string{"main.go"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &GeminiServer{
+				config:     &Config{GitHubAPIBaseURL: server.URL, MaxGitHubFiles: 10, MaxGitHubFileSize: 1024, MinFileSize: tt.minSize},
+				httpClient: &http.Client{Timeout: 5 * time.Second},
+			}
+			files := []string{"main.go", "pkg/__init__.py"}
+			uploads, errs := fetchFromGitHub(context.Background(), s, "o/r", "", files)
+			require.Empty(t, errs)
+			var got []string
+			for _, u := range uploads {
+				got = append(got, u.FileName)
+			}
+			assert.Equal(t, tt.want, got)
+
+			var inv fileInventory
+			recordFileFetchOutcome(&inv, files, uploads, errs)
+			assert.Empty(t, inv.Failed, "skipped files are not failures")
+		})
+	}
+}
+
+func TestFetchFromGitHubReturnsPromptlyOnCancel(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Send headers and part of the body, then stall so the client is
+		// stuck in the body read when the context is cancelled.
+		w.Header().Set("Content-Length", "1000")
+		_, _ = io.WriteString(w, "partial")
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	s := &GeminiServer{
+		config:     &Config{GitHubAPIBaseURL: server.URL, MaxGitHubFiles: 10, MaxGitHubFileSize: 4096},
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+	files := []string{"a.go", "b.go", "c.go", "d.go", "e.go", "f.go"} // more than the 4 concurrent slots
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	start := time.Now()
+	uploads, errs := fetchFromGitHub(ctx, s, "o/r", "", files)
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.Empty(t, uploads)
+	require.Len(t, errs, len(files))
+	for _, err := range errs {
+		assert.ErrorIs(t, err, context.Canceled)
+	}
+}
+
+func TestFetchFromGitHubMaxTotalBytes(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		time.Sleep(20 * time.Millisecond) // let the cap trip while later files are still queued
+		_, _ = io.WriteString(w, strings.Repeat("x", 100))
+	}))
+	defer server.Close()
+
+	files := []string{"a.go", "b.go", "c.go", "d.go", "e.go", "f.go", "g.go", "h.go"}
+	for _, tt := range []struct {
+		name    string
+		limit   int64
+		wantErr bool
+	}{
+		{"no cap", 0, false},
+		{"cap above total", 800, false},
+		{"cap crossed", 250, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			requests.Store(0)
+			s := &GeminiServer{
+				config:     &Config{GitHubAPIBaseURL: server.URL, MaxGitHubFiles: 10, MaxGitHubFileSize: 1024, MaxGitHubTotalBytes: tt.limit},
+				httpClient: &http.Client{Timeout: 5 * time.Second},
+			}
+			uploads, errs := fetchFromGitHub(context.Background(), s, "o/r", "", files)
+			if !tt.wantErr {
+				require.Empty(t, errs)
+				assert.Len(t, uploads, len(files))
+				return
+			}
+			assert.Nil(t, uploads)
+			require.Len(t, errs, 1)
+			assert.Contains(t, errs[0].Error(), "GEMINI_MAX_GITHUB_TOTAL_BYTES")
+			assert.Less(t, int(requests.Load()), len(files), "remaining fetches must be aborted")
+		})
+	}
+}
+
+func TestFetchSingleFileRawHost(t *testing.T) {
+	var gotPath, gotAuth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotAuth = r.URL.EscapedPath(), r.Header.Get("Authorization")
+		_, _ = io.WriteString(w, "content")
+	}))
+	defer server.Close()
+
+	for _, tt := range []struct {
+		name, token, ref, wantPath string
+	}{
+		{"public fetch uses raw host", "", "v1.0", "/raw/o/r/v1.0/src/my%20file.go"},
+		{"empty ref resolves HEAD", "", "", "/raw/o/r/HEAD/src/my%20file.go"},
+		{"branch with slash", "", "feature/x", "/raw/o/r/feature/x/src/my%20file.go"},
+		{"authenticated fetch uses API", "t", "v1.0", "/api/repos/o/r/contents/src/my%20file.go"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &GeminiServer{
+				config: &Config{
+					GitHubAPIBaseURL: server.URL + "/api", GitHubRawHost: server.URL + "/raw",
+					GitHubToken: tt.token, MaxGitHubFileSize: 1024,
+				},
+				httpClient: &http.Client{Timeout: 5 * time.Second},
+			}
+			upload, err := fetchSingleFile(context.Background(), s, s.httpClient, "o", "r", "src/my file.go", tt.ref)
+			require.NoError(t, err)
+			assert.Equal(t, "content", string(upload.Content))
+			assert.Equal(t, tt.wantPath, gotPath)
+			if tt.token != "" {
+				assert.Equal(t, "token t", gotAuth)
+			} else {
+				assert.Empty(t, gotAuth)
+			}
+		})
+	}
+}
@@ -1,9 +1,14 @@
 package main
 
 import (
+	"cmp"
 	"context"
+	"errors"
 	"fmt"
+	"regexp"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/mark3labs/mcp-go/mcp"
 )
@@ -30,19 +35,42 @@ func (s *GeminiServer) GeminiAskHandler(ctx context.Context, req mcp.CallToolReq
 	if err != nil {
 		return createErrorResult(err.Error()), nil
 	}
+	if re := matchDeniedQuery(s.config.QueryDenyPatterns, query); re != nil {
+		logger.Warn("query rejected by GEMINI_QUERY_DENY_PATTERNS: matched %q", re.String())
+		return createErrorResult("Query rejected by server policy."), nil
+	}
+	if token := extractArgumentString(req, "github_token"); token != "" {
+		// On HTTP only an authenticated caller may substitute credentials;
+		// stdio is the operator's own process.
+		if !isStdioRequest(ctx) && !isAuthenticated(ctx) {
+			return createErrorResult("'github_token' is only accepted on authenticated requests."), nil
+		}
+		ctx = context.WithValue(ctx, githubTokenKey, token)
+	}
 	for _, name := range []string{"model", "thinking_level"} {
 		if _, ok := req.GetArguments()[name]; ok {
 			logger.Debug("ignoring legacy parameter %s", name)
 		}
 	}
 
+	var timing *requestTiming
+	if req.GetBool("timing", false) {
+		timing = &requestTiming{start: time.Now()}
+		ctx = context.WithValue(ctx, requestTimingKey, timing)
+	}
+
 	promptCtx, cancelPrompt := context.WithCancel(ctx)
 	defer cancelPrompt()
 	promptCh := s.resolveSystemPromptAsync(promptCtx, req, query, logger)
 
+	fetchStart := time.Now()
 	ghContextParts, uploads, inventory, allWarnings, errResult := s.gatherAllContext(ctx, req)
+	if timing != nil {
+		timing.fetch = time.Since(fetchStart)
+	}
 	if errResult != nil {
 		cancelPrompt()
+		timing.attach(errResult)
 		return errResult, nil
 	}
 
@@ -57,9 +85,99 @@ func (s *GeminiServer) GeminiAskHandler(ctx context.Context, req mcp.CallToolReq
 
 	// Process with context if anything was attached
 	if len(ghContextParts) > 0 || len(uploads) > 0 {
-		return s.processWithFiles(ctx, req, query, ghContextParts, uploads, allWarnings, inventory.Repo, prompt.Category, systemPrompt)
+		result, err := s.processWithFiles(ctx, req, query, ghContextParts, uploads, allWarnings, inventory.Repo, prompt.Category, systemPrompt)
+		attachFileFetchSummary(result, inventory.Files)
+		attachContextFiles(result, uploads)
+		timing.attach(result)
+		return result, err
+	}
+	result, err := s.processWithoutFiles(ctx, req, query, prompt.Category, systemPrompt)
+	timing.attach(result)
+	return result, err
+}
+
+// requestTiming is the per-call phase breakdown returned in _meta.timing when
+// gemini_ask is called with timing=true. Fetch covers all GitHub context,
+// upload the conversion of fetched files into envelope parts, and generate
+// the provider call including retries, failover and escalation.
+type requestTiming struct {
+	start    time.Time
+	fetch    time.Duration
+	upload   time.Duration
+	generate time.Duration
+}
+
+// requestTimingFrom returns the timer installed by GeminiAskHandler, or nil
+// when timing was not requested.
+func requestTimingFrom(ctx context.Context) *requestTiming {
+	t, _ := ctx.Value(requestTimingKey).(*requestTiming)
+	return t
+}
+
+// attach writes the breakdown to result's _meta.timing. Safe on a nil timer.
+func (t *requestTiming) attach(result *mcp.CallToolResult) {
+	if t == nil || result == nil {
+		return
+	}
+	setResultMeta(result, "timing", map[string]int64{
+		"fetch_ms":    t.fetch.Milliseconds(),
+		"upload_ms":   t.upload.Milliseconds(),
+		"generate_ms": t.generate.Milliseconds(),
+		"total_ms":    time.Since(t.start).Milliseconds(),
+	})
+}
+
+// attachFileFetchSummary records which github_files were attached, which were
+// dropped (with the reason) and which were skipped by GEMINI_MIN_FILE_SIZE in
+// the result's _meta.file_fetch_summary. Nothing is added when github_files
+// was not used or the call failed.
+func attachFileFetchSummary(result *mcp.CallToolResult, files fileInventory) {
+	if result == nil || result.IsError || (len(files.Fetched) == 0 && len(files.Failed) == 0 && len(files.Skipped) == 0) {
+		return
+	}
+	fetched := files.Fetched
+	if fetched == nil {
+		fetched = []string{}
+	}
+	failed := files.Failed
+	if failed == nil {
+		failed = []fileFetchFailure{}
+	}
+	skipped := files.Skipped
+	if skipped == nil {
+		skipped = []string{}
+	}
+	setResultMeta(result, "file_fetch_summary", map[string]any{
+		"fetched": fetched,
+		"failed":  failed,
+		"skipped": skipped,
+	})
+}
+
+// attachContextFiles lists every file attached as context — name, size in
+// bytes and MIME type — in the result's _meta.context_files, so a client can
+// reproduce exactly what the answer was based on.
+func attachContextFiles(result *mcp.CallToolResult, uploads []*FileUploadRequest) {
+	if result == nil || result.IsError || len(uploads) == 0 {
+		return
 	}
-	return s.processWithoutFiles(ctx, req, query, prompt.Category, systemPrompt)
+	files := make([]contextFile, 0, len(uploads))
+	for _, u := range uploads {
+		files = append(files, contextFile{Name: u.FileName, Size: len(u.Content), MIMEType: u.MimeType})
+	}
+	setResultMeta(result, "context_files", files)
+}
+
+// matchDeniedQuery returns the first deny pattern matching query, or nil.
+// The pattern is logged server-side only; clients get a generic policy error
+// so the denylist itself is not disclosed.
+func matchDeniedQuery(patterns []*regexp.Regexp, query string) *regexp.Regexp {
+	for _, re := range patterns {
+		if re.MatchString(query) {
+			return re
+		}
+	}
+	return nil
 }
 
 // gatherAllContext runs the two independent context-gathering paths (GitHub
@@ -84,13 +202,11 @@ func (s *GeminiServer) gatherAllContext(
 	// file-fetch failure becomes a warning (not a hard-fail) whenever other
 	// github_* sources were also requested — even if those other sources
 	// themselves failed. The consolidated decision below sees both paths.
-	uploads, fileWarnings, errResult := s.gatherFileUploads(ctx, req, spec.any())
+	uploads, fileWarnings, errResult := s.gatherFileUploads(ctx, req, spec.any(), &inventory.Files)
 	if errResult != nil {
 		return nil, nil, inventory, nil, errResult
 	}
 
-	finalizeFilesInventory(req, &inventory, len(uploads))
-
 	allWarnings := append([]string{}, ghWarnings...)
 	allWarnings = append(allWarnings, fileWarnings...)
 
@@ -99,23 +215,52 @@ func (s *GeminiServer) gatherAllContext(
 		return nil, nil, inventory, nil, errResult
 	}
 
+	// The README is added after the "nothing succeeded" check so it never
+	// turns a request whose sources all failed into a README-only answer.
+	githubFiles := extractArgumentStringArray(req, "github_files")
+	if (spec.any() || len(githubFiles) > 0) && req.GetBool("include_readme", s.config.AutoIncludeReadme) {
+		var readmeWarnings []string
+		uploads, readmeWarnings = s.prependReadme(ctx, s.githubRepo(req), s.githubRef(req), uploads, len(githubFiles))
+		allWarnings = append(allWarnings, readmeWarnings...)
+	}
+	s.finalizeFilesInventory(req, &inventory, len(uploads))
+
 	return ghContextParts, uploads, inventory, allWarnings, nil
 }
 
-// finalizeFilesInventory records uploaded files in the inventory when they
-// were sourced from github_files.
-func finalizeFilesInventory(req mcp.CallToolRequest, inv *contextInventory, uploadCount int) {
+// finalizeFilesInventory records the uploaded files — github_files plus the
+// include_readme README — in the inventory.
+func (s *GeminiServer) finalizeFilesInventory(req mcp.CallToolRequest, inv *contextInventory, uploadCount int) {
 	if uploadCount == 0 {
 		return
 	}
-	if len(extractArgumentStringArray(req, "github_files")) == 0 {
-		return
-	}
 	inv.Files.Count = uploadCount
-	inv.Files.Ref = extractArgumentString(req, "github_ref")
+	inv.Files.Ref = s.githubRef(req)
 	if inv.Repo == "" {
-		inv.Repo = extractArgumentString(req, "github_repo")
+		inv.Repo = s.githubRepo(req)
+	}
+}
+
+// githubRepo returns the request's github_repo, falling back to
+// GEMINI_DEFAULT_GITHUB_REPO when the call omits it.
+func (s *GeminiServer) githubRepo(req mcp.CallToolRequest) string {
+	if repo := extractArgumentString(req, "github_repo"); repo != "" {
+		return repo
+	}
+	return s.config.DefaultGitHubRepo
+}
+
+// githubRef returns the request's github_ref. GEMINI_DEFAULT_GITHUB_REF is
+// only used when the call also targets the default repo, so a ref meant for
+// that repo is never applied to a different one.
+func (s *GeminiServer) githubRef(req mcp.CallToolRequest) string {
+	if ref := extractArgumentString(req, "github_ref"); ref != "" {
+		return ref
+	}
+	if s.config.DefaultGitHubRepo != "" && s.githubRepo(req) == s.config.DefaultGitHubRepo {
+		return s.config.DefaultGitHubRef
 	}
+	return ""
 }
 
 // consolidatedContextError returns a single error result enumerating every
@@ -140,11 +285,11 @@ func consolidatedContextError(
 	return createErrorResult(msg)
 }
 
-// gatherGitHubContext fetches the github_pr / github_commits / github_diff
-// parameters (independently and in parallel-friendly order) and returns the
-// resulting content parts in the stable merge order:
+// gatherGitHubContext fetches the github_tree / github_pr / github_commits /
+// github_diff parameters (independently and in parallel-friendly order) and
+// returns the resulting content parts in the stable merge order:
 //
-//	[commits] → [diff] → [PR bundle]
+//	[tree] → [commits] → [diff] → [PR bundle]
 //
 // Files are intentionally NOT handled here — they're fetched by
 // gatherFileUploads.
@@ -157,10 +302,10 @@ func (s *GeminiServer) gatherGitHubContext(
 		return nil, inv, nil, nil
 	}
 
-	githubRepo := extractArgumentString(req, "github_repo")
+	githubRepo := s.githubRepo(req)
 	if githubRepo == "" {
 		return nil, inv, nil, createErrorResult(
-			"'github_repo' is required when using 'github_pr', 'github_commits', or 'github_diff_base'/'github_diff_head'.")
+			"'github_repo' is required when using 'github_tree', 'github_pr', 'github_commits', or 'github_diff_base'/'github_diff_head'.")
 	}
 	owner, repo, err := parseGitHubRepo(githubRepo)
 	if err != nil {
@@ -171,6 +316,9 @@ func (s *GeminiServer) gatherGitHubContext(
 	if spec.wantsDiff && (spec.diffBase == "" || spec.diffHead == "") {
 		return nil, inv, nil, createErrorResult("'github_diff_base' and 'github_diff_head' must both be provided.")
 	}
+	if spec.tree {
+		spec.treeRef = s.githubRef(req)
+	}
 
 	parts, warnings, errResult := s.fetchGitHubContextSources(ctx, owner, repo, spec, &inv)
 	if errResult != nil {
@@ -185,6 +333,8 @@ func (s *GeminiServer) gatherGitHubContext(
 
 // githubContextSpec describes which github_* sources the client requested.
 type githubContextSpec struct {
+	tree      bool
+	treeRef   string // resolved in gatherGitHubContext (github_ref or the default ref)
 	hasPR     bool
 	prNumber  int
 	commits   []string
@@ -194,7 +344,7 @@ type githubContextSpec struct {
 }
 
 func (g githubContextSpec) any() bool {
-	return g.hasPR || len(g.commits) > 0 || g.wantsDiff
+	return g.tree || g.hasPR || len(g.commits) > 0 || g.wantsDiff
 }
 
 func parseGitHubContextSpec(req mcp.CallToolRequest) githubContextSpec {
@@ -202,6 +352,7 @@ func parseGitHubContextSpec(req mcp.CallToolRequest) githubContextSpec {
 	diffBase := extractArgumentString(req, "github_diff_base")
 	diffHead := extractArgumentString(req, "github_diff_head")
 	return githubContextSpec{
+		tree:      req.GetBool("github_tree", false),
 		hasPR:     hasPR,
 		prNumber:  prNumber,
 		commits:   extractArgumentStringArray(req, "github_commits"),
@@ -212,7 +363,8 @@ func parseGitHubContextSpec(req mcp.CallToolRequest) githubContextSpec {
 }
 
 // fetchGitHubContextSources runs the actual fetches in stable merge order
-// (commits → diff → PR) and accumulates parts, warnings, and inventory state.
+// (tree → commits → diff → PR) and accumulates parts, warnings, and inventory
+// state.
 func (s *GeminiServer) fetchGitHubContextSources(
 	ctx context.Context, owner, repo string, spec githubContextSpec, inv *contextInventory,
 ) ([]ContentPart, []string, *mcp.CallToolResult) {
@@ -220,6 +372,17 @@ func (s *GeminiServer) fetchGitHubContextSources(
 	var parts []ContentPart
 	var warnings []string
 
+	if spec.tree {
+		treeParts, treeInv, err := s.gatherTree(ctx, owner, repo, spec.treeRef)
+		if err != nil {
+			logger.Error("Tree fetch failed: %v", err)
+			warnings = append(warnings, fmt.Sprintf("github_tree: %v", err))
+		} else {
+			parts = append(parts, treeParts...)
+			inv.Tree = treeInv
+		}
+	}
+
 	if len(spec.commits) > 0 {
 		commitParts, commitInv, commitWarnings, err := s.gatherCommits(ctx, owner, repo, spec.commits)
 		if err != nil {
@@ -272,6 +435,7 @@ func buildContextInventoryAddendum(inv *contextInventory) string {
 	}
 	b.WriteString(", inside a <context> element (your instructions are inside a <task> element):\n")
 
+	writeTreeInventory(&b, inv.Tree)
 	writeFilesInventory(&b, inv.Files)
 	writeCommitsInventory(&b, inv.Commits)
 	writeDiffInventory(&b, inv.Diff)
@@ -299,6 +463,21 @@ func writeCommitsInventory(b *strings.Builder, commits []commitInventory) {
 	fmt.Fprintf(b, "- %d <commit> element(s)\n", len(commits))
 }
 
+func writeTreeInventory(b *strings.Builder, t *treeInventory) {
+	if t == nil {
+		return
+	}
+	ref := t.Ref
+	if ref == "" {
+		ref = "the default branch"
+	}
+	suffix := ""
+	if t.Truncated {
+		suffix = " (listing was truncated)"
+	}
+	fmt.Fprintf(b, "- A <tree> element listing %d path(s) at %s%s\n", t.Entries, ref, suffix)
+}
+
 func writeDiffInventory(b *strings.Builder, d *diffInventory) {
 	if d == nil {
 		return
@@ -333,9 +512,9 @@ func writePRInventory(b *strings.Builder, pr *prInventory) {
 // The otherGitHubContextPresent flag relaxes the "files requested but none
 // gathered" hard-fail when another github-sourced context block was already
 // successfully attached — in that case the request has useful content and
-// the failed files become warnings.
+// the failed files become warnings. Per-path outcomes are recorded in inv.
 func (s *GeminiServer) gatherFileUploads(
-	ctx context.Context, req mcp.CallToolRequest, otherGitHubContextPresent bool,
+	ctx context.Context, req mcp.CallToolRequest, otherGitHubContextPresent bool, inv *fileInventory,
 ) ([]*FileUploadRequest, []string, *mcp.CallToolResult) {
 	logger := getLoggerFromContext(ctx)
 
@@ -346,7 +525,7 @@ func (s *GeminiServer) gatherFileUploads(
 		return nil, nil, nil
 	}
 
-	uploads, warnings, errResult := s.gatherGitHubFiles(ctx, req, githubFiles)
+	uploads, warnings, errResult := s.gatherGitHubFiles(ctx, req, githubFiles, inv)
 	if errResult != nil {
 		return s.handleFileUploadError(errResult, warnings, githubFiles, otherGitHubContextPresent)
 	}
@@ -356,10 +535,20 @@ func (s *GeminiServer) gatherFileUploads(
 	// unless other github context was attached successfully, in which case
 	// this is a partial failure that should surface as warnings.
 	if len(uploads) == 0 {
+		allSkipped := inv != nil && len(inv.Skipped) > 0 && len(inv.Failed) == 0
 		if otherGitHubContextPresent {
 			logger.Warn("files requested but none gathered; other GitHub context present, continuing")
+			if allSkipped {
+				warnings = append(warnings, fmt.Sprintf("github_files: all files are below GEMINI_MIN_FILE_SIZE (%d bytes)", s.config.MinFileSize))
+			}
 			return nil, warnings, nil
 		}
+		if allSkipped {
+			logger.Warn("All %d requested files are below GEMINI_MIN_FILE_SIZE", len(inv.Skipped))
+			return nil, nil, createErrorResult(fmt.Sprintf(
+				"All requested github_files are below the minimum file size of %d bytes (GEMINI_MIN_FILE_SIZE); nothing to attach.",
+				s.config.MinFileSize))
+		}
 		logger.Error("Files were requested but none could be gathered")
 		return nil, nil, createErrorResult("Failed to retrieve any of the requested files. Cannot proceed without file context.")
 	}
@@ -384,38 +573,37 @@ func (s *GeminiServer) handleFileUploadError(
 
 // gatherGitHubFiles fetches files from a GitHub repository.
 // Returns uploads, warning messages for failed files, and an optional error result.
+// The fetched and failed paths are recorded in inv.
 func (s *GeminiServer) gatherGitHubFiles(
-	ctx context.Context, req mcp.CallToolRequest, githubFiles []string,
+	ctx context.Context, req mcp.CallToolRequest, githubFiles []string, inv *fileInventory,
 ) ([]*FileUploadRequest, []string, *mcp.CallToolResult) {
 	logger := getLoggerFromContext(ctx)
 	logger.Info("Processing GitHub files request")
 
-	githubRepo := extractArgumentString(req, "github_repo")
+	githubRepo := s.githubRepo(req)
 	if githubRepo == "" {
 		logger.Error("GitHub repository parameter missing")
 		return nil, nil, createErrorResult("'github_repo' is required when using 'github_files'.")
 	}
 
-	githubRef := extractArgumentString(req, "github_ref")
+	githubRef := s.githubRef(req)
 
 	// Validate and fetch
 	if err := validateFilePathArray(githubFiles); err != nil {
 		logger.Error("GitHub file path validation failed: %v", err)
 		return nil, nil, createErrorResult(err.Error())
 	}
+	githubFiles = normalizeGitHubFilePaths(githubFiles)
 
 	fetchedUploads, fileErrs := fetchFromGitHub(ctx, s, githubRepo, githubRef, githubFiles)
+	if inv == nil {
+		inv = &fileInventory{}
+	}
+	recordFileFetchOutcome(inv, githubFiles, fetchedUploads, fileErrs)
 	var warnings []string
 	if len(fileErrs) > 0 {
-		// Build a set of successfully fetched filenames to identify which ones failed
-		fetched := make(map[string]bool, len(fetchedUploads))
-		for _, u := range fetchedUploads {
-			fetched[u.FileName] = true
-		}
-		for _, file := range githubFiles {
-			if !fetched[file] {
-				warnings = append(warnings, fmt.Sprintf("%s: could not be fetched from GitHub", file))
-			}
+		for _, failed := range inv.Failed {
+			warnings = append(warnings, fmt.Sprintf("%s: could not be fetched from GitHub", failed.Path))
 		}
 		for _, err := range fileErrs {
 			logger.Error("Error processing github file: %v", err)
@@ -430,6 +618,43 @@ func (s *GeminiServer) gatherGitHubFiles(
 	return fetchedUploads, warnings, nil
 }
 
+// recordFileFetchOutcome fills inv.Fetched / inv.Failed / inv.Skipped from a
+// fetchFromGitHub result. Failures are matched to paths through
+// fileFetchError; after a batch-level failure (no per-path errors) every path
+// gets a generic reason. Otherwise a path with neither an upload nor an error
+// was skipped by GEMINI_MIN_FILE_SIZE and is not a failure.
+func recordFileFetchOutcome(inv *fileInventory, requested []string, uploads []*FileUploadRequest, errs []error) {
+	if inv == nil {
+		return
+	}
+	reasons := make(map[string]string, len(errs))
+	for _, err := range errs {
+		if ffe, ok := errors.AsType[*fileFetchError](err); ok {
+			reasons[ffe.path] = ffe.err.Error()
+		}
+	}
+	batchFailure := len(errs) > 0 && len(reasons) == 0
+	fetched := make(map[string]bool, len(uploads))
+	for _, u := range uploads {
+		fetched[u.FileName] = true
+		inv.Fetched = append(inv.Fetched, u.FileName)
+	}
+	for _, file := range requested {
+		if fetched[file] {
+			continue
+		}
+		reason := reasons[file]
+		if reason == "" {
+			if !batchFailure {
+				inv.Skipped = append(inv.Skipped, file)
+				continue
+			}
+			reason = "could not be fetched from GitHub"
+		}
+		inv.Failed = append(inv.Failed, fileFetchFailure{Path: file, Reason: reason})
+	}
+}
+
 // processWithFiles handles a provider request with any combination of
 // pre-built github-context XML parts (commits / diff / PR bundle) and file
 // attachments. Everything is placed BEFORE the query to maximise implicit
@@ -437,7 +662,7 @@ func (s *GeminiServer) gatherGitHubFiles(
 //
 // The stable merge order is:
 //
-//	<context> [commits] → [diff] → [PR bundle] → [files] </context> → <task><query>…</query></task> → <final_instruction>
+//	<context> [tree] → [commits] → [diff] → [PR bundle] → [files] </context> → <task><query>…</query></task> → <final_instruction>
 //
 // contextParts MUST already be in the above order when passed in.
 func (s *GeminiServer) processWithFiles(ctx context.Context, req mcp.CallToolRequest, query string,
@@ -452,8 +677,13 @@ func (s *GeminiServer) processWithFiles(ctx context.Context, req mcp.CallToolReq
 	}
 
 	logger.Info("Processing %d file(s) for inline injection", len(uploads))
-	githubRef := extractArgumentString(req, "github_ref")
+	githubRef := s.githubRef(req)
+	uploads = orderUploadsByPriority(uploads, extractArgumentIntMap(req, "file_priority"))
+	uploadStart := time.Now()
 	fileParts := s.buildFileParts(ctx, uploads, githubRef, logger)
+	if t := requestTimingFrom(ctx); t != nil {
+		t.upload = time.Since(uploadStart)
+	}
 
 	parts := wrapUserTurnWithContext(repo, contextParts, fileParts, query, warnings, finalInstructionFor(category))
 
@@ -490,18 +720,23 @@ func (s *GeminiServer) processWithFiles(ctx context.Context, req mcp.CallToolReq
 		progressLabel(s.config.ActiveModel()),
 		logger)
 	defer stop()
-	response, err := withRetryClassified(
-		callCtx, s.config, logger, "provider.generate", s.provider.IsRetryable,
-		func(ctx context.Context) (*GenerationResponse, error) {
-			return s.provider.Generate(ctx, genReq)
-		},
-	)
+	start := time.Now()
+	response, served, err := s.generate(callCtx, genReq, logger)
+	elapsed := time.Since(start)
+	if t := requestTimingFrom(ctx); t != nil {
+		t.generate = elapsed
+	}
 	if err != nil {
 		logAPIError(callCtx, logger, "Provider API error", err)
 		return createErrorResult(fmt.Sprintf("Error from provider API: %v", err)), nil
 	}
 
-	return convertResponseToMCPResult(response, logger), nil
+	s.writeTrace(req, genReq, served, response, elapsed, logger)
+	result := s.buildToolResult(ctx, genReq, served, response, elapsed, logger)
+	if req.GetBool("include_usage", false) {
+		s.appendUsageContent(result, response)
+	}
+	return result, nil
 }
 
 // buildFileParts converts file uploads to the XML <file> fragments emitted
@@ -532,6 +767,32 @@ func (s *GeminiServer) buildFileParts(
 	return fileParts
 }
 
+// orderUploadsByPriority returns uploads sorted by descending file_priority so
+// the most relevant files sit earliest in <context>. Keys are normalized the
+// same way as github_files; unlisted files default to 0 and ties keep the
+// deterministic path order fetchFromGitHub returns. Pinned uploads (the
+// include_readme README) always stay in front.
+func orderUploadsByPriority(uploads []*FileUploadRequest, priorities map[string]int) []*FileUploadRequest {
+	if len(priorities) == 0 || len(uploads) < 2 {
+		return uploads
+	}
+	normalized := make(map[string]int, len(priorities))
+	for name, p := range priorities {
+		normalized[normalizeGitHubFilePath(name)] = p
+	}
+	ordered := slices.Clone(uploads)
+	slices.SortStableFunc(ordered, func(a, b *FileUploadRequest) int {
+		if a.pinned != b.pinned {
+			if a.pinned {
+				return -1
+			}
+			return 1
+		}
+		return cmp.Compare(normalized[b.FileName], normalized[a.FileName])
+	})
+	return ordered
+}
+
 func renderTextFilePart(upload *FileUploadRequest, githubRef string) ContentPart {
 	return ContentPart{Text: fmt.Sprintf(
 		"  <file path=\"%s\" ref=\"%s\" kind=\"text\" mime=\"%s\">%s</file>\n",
@@ -579,17 +840,79 @@ func (s *GeminiServer) processWithoutFiles(ctx context.Context, req mcp.CallTool
 		progressLabel(s.config.ActiveModel()),
 		logger)
 	defer stop()
-	response, err := withRetryClassified(
-		callCtx, s.config, logger, "provider.generate", s.provider.IsRetryable,
+	start := time.Now()
+	response, served, err := s.generate(callCtx, genReq, logger)
+	if err != nil {
+		logAPIError(callCtx, logger, "Provider API error", err)
+	}
+
+	elapsed := time.Since(start)
+	if t := requestTimingFrom(ctx); t != nil {
+		t.generate = elapsed
+	}
+	s.writeTrace(req, genReq, served, response, elapsed, logger)
+	result := s.buildToolResult(ctx, genReq, served, response, elapsed, logger)
+	if req.GetBool("include_usage", false) {
+		s.appendUsageContent(result, response)
+	}
+	return result, nil
+}
+
+// generate runs genReq on the main provider with retries. If the primary
+// still fails with a transient (non-client) error and a failover provider is
+// configured, the request is served by the failover instead. When the answer
+// comes back empty for a reason other than the content filter and an
+// escalator is configured for the provider that answered, the request is
+// retried once on the larger model; if that also fails, the original
+// response is kept. served is the provider configuration that produced the
+// returned response.
+func (s *GeminiServer) generate(
+	ctx context.Context, genReq GenerationRequest, logger Logger,
+) (response *GenerationResponse, served ProviderConfig, err error) {
+	provider, escalator := s.provider, s.escalator
+	served = s.config.Provider
+	response, err = withRetryClassified(
+		ctx, s.config, logger, "provider.generate", provider.IsRetryable,
 		func(ctx context.Context) (*GenerationResponse, error) {
-			return s.provider.Generate(ctx, genReq)
+			return provider.Generate(ctx, genReq)
 		},
 	)
-	if err != nil {
-		logAPIError(callCtx, logger, "Provider API error", err)
+	if err != nil && s.failover != nil && ctx.Err() == nil && classifyRetryable(err, s.provider.IsRetryable) {
+		logger.Warn("Primary provider %s failed (%v); failing over to %s/%s",
+			s.config.Provider.Vendor, err, s.config.FailoverProvider.Vendor, s.config.FailoverProvider.Model)
+		served, provider, escalator = *s.config.FailoverProvider, s.failover, s.failoverEscalator
+		response, err = withRetryClassified(
+			ctx, s.config, logger, "provider.generate.failover", provider.IsRetryable,
+			func(ctx context.Context) (*GenerationResponse, error) {
+				return provider.Generate(ctx, genReq)
+			},
+		)
+	}
+	if err != nil || escalator == nil || !shouldEscalate(response) {
+		return response, served, err
+	}
+	target, _ := s.config.escalationTarget(served.Model)
+	logger.Warn("Empty response from %s (finish=%s); escalating to %s",
+		served.Model, response.FinishReason, target)
+	escalated, escErr := withRetryClassified(
+		ctx, s.config, logger, "provider.generate.escalated", escalator.IsRetryable,
+		func(ctx context.Context) (*GenerationResponse, error) {
+			return escalator.Generate(ctx, genReq)
+		},
+	)
+	if escErr != nil {
+		logAPIError(ctx, logger, "Escalated provider API error", escErr)
+		return response, served, nil
 	}
+	served.Model = target
+	return escalated, served, nil
+}
 
-	return convertResponseToMCPResult(response, logger), nil
+// shouldEscalate reports whether resp is an empty answer worth retrying on a
+// larger model. Content-filtered answers are not: the vendor filter applies
+// to every model.
+func shouldEscalate(resp *GenerationResponse) bool {
+	return resp != nil && strings.TrimSpace(resp.Text) == "" && !finishReasonSafety(resp.FinishReason)
 }
 
 func loggerDebugEnabled(logger Logger) bool {
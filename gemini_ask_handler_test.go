@@ -2,7 +2,21 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"text/template"
 	"time"
 
 	"github.com/mark3labs/mcp-go/mcp"
@@ -26,7 +40,10 @@ func TestConvertResponseToMCPResult(t *testing.T) {
 		want     string
 		isError  bool
 	}{
-		{"abnormal finish", &GenerationResponse{Text: "cut", FinishReason: "MAX_TOKENS"}, "[WARN finish_reason=MAX_TOKENS]\ncut", false},
+		{"abnormal finish", &GenerationResponse{Text: "filtered", FinishReason: "content_filter"}, "[WARN finish_reason=content_filter]\nfiltered", false},
+		{"max tokens", &GenerationResponse{Text: "cut", FinishReason: "MAX_TOKENS"}, "[WARN finish_reason=MAX_TOKENS]\ncut\n\n" + truncationNote, false},
+		{"chat completions length", &GenerationResponse{Text: "cut", FinishReason: "length"}, "cut\n\n[NOTE] This answer was truncated", false},
+		{"responses max_output_tokens", &GenerationResponse{Text: "cut", FinishReason: "max_output_tokens"}, "PROVIDER_MAX_TOKENS", false},
 		{"empty text", &GenerationResponse{FinishReason: "STOP"}, "Please try rephrasing", false},
 		{"nil", nil, "provider returned an empty response", true},
 	}
@@ -35,6 +52,857 @@ func TestConvertResponseToMCPResult(t *testing.T) {
 			result := convertResponseToMCPResult(tt.response, NewLogger(LevelError))
 			assert.Equal(t, tt.isError, result.IsError)
 			assert.Contains(t, toolResultText(t, result), tt.want)
+			truncated := tt.response != nil && finishReasonTruncated(tt.response.FinishReason)
+			if truncated {
+				require.NotNil(t, result.Meta)
+				assert.Equal(t, true, result.Meta.AdditionalFields["truncated"])
+			} else if result.Meta != nil {
+				assert.NotContains(t, result.Meta.AdditionalFields, "truncated")
+			}
+		})
+	}
+}
+
+func TestOrderUploadsByPriority(t *testing.T) {
+	uploads := []*FileUploadRequest{{FileName: "a.go"}, {FileName: "b.go"}, {FileName: "src/c.go"}, {FileName: "d.go"}}
+	names := func(us []*FileUploadRequest) []string {
+		out := make([]string, len(us))
+		for i, u := range us {
+			out[i] = u.FileName
+		}
+		return out
+	}
+	tests := []struct {
+		name       string
+		priorities map[string]int
+		want       []string
+	}{
+		{"none keeps order", nil, []string{"a.go", "b.go", "src/c.go", "d.go"}},
+		{"descending", map[string]int{"./src/c.go": 10, "b.go": 5}, []string{"src/c.go", "b.go", "a.go", "d.go"}},
+		{"negative sinks, ties stable", map[string]int{"a.go": -1}, []string{"b.go", "src/c.go", "d.go", "a.go"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, names(orderUploadsByPriority(uploads, tt.priorities)))
+		})
+	}
+	assert.Equal(t, []string{"a.go", "b.go", "src/c.go", "d.go"}, names(uploads), "input must not be reordered in place")
+}
+
+func TestProcessWithFilesHonoursFilePriority(t *testing.T) {
+	provider := &mockProvider{}
+	s := &GeminiServer{config: &Config{Provider: ProviderConfig{Model: "test"}, HTTPTimeout: time.Second}, provider: provider}
+	uploads := []*FileUploadRequest{
+		{FileName: "first.go", MimeType: "text/plain", Content: []byte("one")},
+		{FileName: "second.go", MimeType: "text/plain", Content: []byte("two")},
+	}
+	req := mcp.CallToolRequest{Params: mcp.CallToolParams{Arguments: map[string]any{
+		"query": "q", "file_priority": map[string]any{"second.go": float64(3)},
+	}}}
+	_, err := s.processWithFiles(context.Background(), req, "q", nil, uploads, nil, "o/r", categoryGeneral, "sys")
+	require.NoError(t, err)
+	require.Len(t, provider.requests(), 1)
+	var body strings.Builder
+	for _, p := range provider.requests()[0].Parts {
+		body.WriteString(p.Text)
+	}
+	text := body.String()
+	assert.Less(t, strings.Index(text, `path="second.go"`), strings.Index(text, `path="first.go"`))
+}
+
+func TestGeminiAskHandlerReportsModelUsed(t *testing.T) {
+	tests := []struct {
+		name     string
+		reported string
+		want     any
+	}{
+		{"snapshot differs from alias", "deepseek-v4-pro-2026-09", "deepseek-v4-pro-2026-09"},
+		{"not reported", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &mockProvider{generateFn: func(context.Context, GenerationRequest) (*GenerationResponse, error) {
+				return &GenerationResponse{Text: "ok", FinishReason: "stop", Model: tt.reported}, nil
+			}}
+			s := &GeminiServer{config: &Config{Provider: ProviderConfig{Model: "deepseek-v4-pro"}, HTTPTimeout: time.Second}, provider: provider}
+			req := mcp.CallToolRequest{Params: mcp.CallToolParams{Arguments: map[string]any{"query": "hello"}}}
+			result, err := s.GeminiAskHandler(context.Background(), req)
+			require.NoError(t, err)
+			assert.Equal(t, "ok", toolResultText(t, result))
+			require.NotNil(t, result.Meta)
+			assert.Equal(t, tt.want, result.Meta.AdditionalFields["model_used"])
+		})
+	}
+}
+
+// Run with -race: concurrent HTTP sessions share one GeminiServer.
+func TestGeminiAskHandlerConcurrentCalls(t *testing.T) {
+	provider := &mockProvider{}
+	s := &GeminiServer{config: &Config{Provider: ProviderConfig{Model: "test"}, HTTPTimeout: time.Second}, provider: provider}
+
+	envBefore := os.Environ()
+	const calls = 16
+	var wg sync.WaitGroup
+	for i := range calls {
+		wg.Go(func() {
+			query := fmt.Sprintf("question %d", i)
+			req := mcp.CallToolRequest{Params: mcp.CallToolParams{Arguments: map[string]any{"query": query}}}
+			result, err := s.GeminiAskHandler(context.Background(), req)
+			assert.NoError(t, err)
+			assert.False(t, result.IsError)
+		})
+	}
+	wg.Wait()
+	assert.ElementsMatch(t, envBefore, os.Environ(), "the ask path must not mutate process env")
+
+	requests := provider.requests()
+	require.Len(t, requests, calls)
+	seen := make(map[string]bool, calls)
+	for _, r := range requests {
+		seen[r.Parts[0].Text] = true
+	}
+	for i := range calls {
+		assert.True(t, seen[fmt.Sprintf("<task>\n  <query>question %d</query>\n</task>\n\n", i)], "query %d missing", i)
+	}
+}
+
+func TestGeminiAskHandlerFileFetchSummary(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/repos/o/r/contents/ok.go" {
+			_, _ = io.WriteString(w, "package ok")
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	provider := &mockProvider{}
+	s := &GeminiServer{
+		config: &Config{
+			Provider: ProviderConfig{Model: "test"}, HTTPTimeout: time.Second,
+			GitHubAPIBaseURL: server.URL, GitHubToken: "t", MaxGitHubFiles: 5, MaxGitHubFileSize: 1024,
+		},
+		provider:   provider,
+		httpClient: &http.Client{Timeout: 5 * time.Second},
+	}
+	req := mcp.CallToolRequest{Params: mcp.CallToolParams{Arguments: map[string]any{
+		"query": "review", "github_repo": "o/r", "github_files": []any{"ok.go", "missing.go"},
+	}}}
+	result, err := s.GeminiAskHandler(context.Background(), req)
+	require.NoError(t, err)
+	require.False(t, result.IsError)
+	require.NotNil(t, result.Meta)
+	summary, ok := result.Meta.AdditionalFields["file_fetch_summary"].(map[string]any)
+	require.True(t, ok)
+	assert.Equal(t, []string{"ok.go"}, summary["fetched"])
+	failed, ok := summary["failed"].([]fileFetchFailure)
+	require.True(t, ok)
+	require.Len(t, failed, 1)
+	assert.Equal(t, "missing.go", failed[0].Path)
+	assert.Contains(t, failed[0].Reason, "not found")
+}
+
+func TestGeminiAskHandlerMinFileSizeSkips(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/o/r/contents/main.go":
+			_, _ = io.WriteString(w, "package main")
+		case "/repos/o/r/contents/__init__.py":
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	newServer := func() (*GeminiServer, *mockProvider) {
+		provider := &mockProvider{}
+		return &GeminiServer{
+			config: &Config{
+				Provider: ProviderConfig{Model: "test"}, HTTPTimeout: time.Second,
+				GitHubAPIBaseURL: server.URL, MaxGitHubFiles: 5, MaxGitHubFileSize: 1024, MinFileSize: 1,
+			},
+			provider:   provider,
+			httpClient: &http.Client{Timeout: 5 * time.Second},
+		}, provider
+	}
+
+	t.Run("skipped files are reported", func(t *testing.T) {
+		s, _ := newServer()
+		req := mcp.CallToolRequest{Params: mcp.CallToolParams{Arguments: map[string]any{
+			"query": "review", "github_repo": "o/r", "github_files": []any{"main.go", "__init__.py", "missing.go"},
+		}}}
+		result, err := s.GeminiAskHandler(context.Background(), req)
+		require.NoError(t, err)
+		require.False(t, result.IsError, toolResultText(t, result))
+		summary, ok := result.Meta.AdditionalFields["file_fetch_summary"].(map[string]any)
+		require.True(t, ok)
+		assert.Equal(t, []string{"main.go"}, summary["fetched"])
+		assert.Equal(t, []string{"__init__.py"}, summary["skipped"])
+		failed, ok := summary["failed"].([]fileFetchFailure)
+		require.True(t, ok)
+		require.Len(t, failed, 1)
+		assert.Equal(t, "missing.go", failed[0].Path)
+	})
+
+	t.Run("all files skipped", func(t *testing.T) {
+		s, provider := newServer()
+		req := mcp.CallToolRequest{Params: mcp.CallToolParams{Arguments: map[string]any{
+			"query": "review", "github_repo": "o/r", "github_files": []any{"__init__.py"},
+		}}}
+		result, err := s.GeminiAskHandler(context.Background(), req)
+		require.NoError(t, err)
+		require.True(t, result.IsError)
+		assert.Contains(t, toolResultText(t, result), "below the minimum file size of 1 bytes (GEMINI_MIN_FILE_SIZE)")
+		assert.NotContains(t, toolResultText(t, result), "Failed to retrieve")
+		assert.Empty(t, provider.requests())
+	})
+}
+
+func TestGeminiAskHandlerContextFiles(t *testing.T) {
+	contents := map[string]string{"/repos/o/r/contents/main.go": "package main", "/repos/o/r/contents/README.md": "# Title\n"}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, contents[r.URL.Path])
+	}))
+	defer server.Close()
+
+	s := &GeminiServer{
+		config: &Config{
+			Provider: ProviderConfig{Model: "test"}, HTTPTimeout: time.Second,
+			GitHubAPIBaseURL: server.URL, MaxGitHubFiles: 5, MaxGitHubFileSize: 1024,
+		},
+		provider:   &mockProvider{},
+		httpClient: &http.Client{Timeout: 5 * time.Second},
+	}
+	req := mcp.CallToolRequest{Params: mcp.CallToolParams{Arguments: map[string]any{
+		"query": "review", "github_repo": "o/r", "github_files": []any{"main.go", "README.md"},
+	}}}
+	result, err := s.GeminiAskHandler(context.Background(), req)
+	require.NoError(t, err)
+	require.NotNil(t, result.Meta)
+	assert.Equal(t, []contextFile{
+		{Name: "README.md", Size: 8, MIMEType: getMimeTypeFromPath("README.md")},
+		{Name: "main.go", Size: 12, MIMEType: getMimeTypeFromPath("main.go")},
+	}, result.Meta.AdditionalFields["context_files"])
+
+	noFiles := mcp.CallToolRequest{Params: mcp.CallToolParams{Arguments: map[string]any{"query": "hello"}}}
+	result, err = s.GeminiAskHandler(context.Background(), noFiles)
+	require.NoError(t, err)
+	if result.Meta != nil {
+		assert.NotContains(t, result.Meta.AdditionalFields, "context_files")
+	}
+}
+
+func TestGeminiAskHandlerTiming(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "package main")
+	}))
+	defer server.Close()
+
+	s := &GeminiServer{
+		config: &Config{
+			Provider: ProviderConfig{Model: "test"}, HTTPTimeout: time.Second,
+			GitHubAPIBaseURL: server.URL, MaxGitHubFiles: 5, MaxGitHubFileSize: 1024,
+		},
+		provider: &mockProvider{generateFn: func(context.Context, GenerationRequest) (*GenerationResponse, error) {
+			time.Sleep(5 * time.Millisecond)
+			return &GenerationResponse{Text: "ok", FinishReason: "stop"}, nil
+		}},
+		httpClient: &http.Client{Timeout: 5 * time.Second},
+	}
+
+	for _, tt := range []struct {
+		name string
+		args map[string]any
+	}{
+		{"with files", map[string]any{"query": "review", "github_repo": "o/r", "github_files": []any{"main.go"}, "timing": true}},
+		{"query only", map[string]any{"query": "hello", "timing": true}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := s.GeminiAskHandler(context.Background(), mcp.CallToolRequest{Params: mcp.CallToolParams{Arguments: tt.args}})
+			require.NoError(t, err)
+			require.False(t, result.IsError)
+			require.NotNil(t, result.Meta)
+			timing, ok := result.Meta.AdditionalFields["timing"].(map[string]int64)
+			require.True(t, ok)
+			for _, phase := range []string{"fetch_ms", "upload_ms", "generate_ms", "total_ms"} {
+				require.Contains(t, timing, phase)
+				assert.GreaterOrEqual(t, timing[phase], int64(0), phase)
+			}
+			assert.GreaterOrEqual(t, timing["generate_ms"], int64(5))
+			assert.GreaterOrEqual(t, timing["total_ms"], timing["generate_ms"])
+		})
+	}
+
+	t.Run("omitted by default", func(t *testing.T) {
+		req := mcp.CallToolRequest{Params: mcp.CallToolParams{Arguments: map[string]any{"query": "hello"}}}
+		result, err := s.GeminiAskHandler(context.Background(), req)
+		require.NoError(t, err)
+		if result.Meta != nil {
+			assert.NotContains(t, result.Meta.AdditionalFields, "timing")
+		}
+	})
+}
+
+func TestGeminiAskHandlerDefaultGitHubRepoRef(t *testing.T) {
+	var (
+		mu        sync.Mutex
+		requested []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested = append(requested, r.URL.RequestURI())
+		mu.Unlock()
+		_, _ = io.WriteString(w, "package main")
+	}))
+	defer server.Close()
+
+	for _, tt := range []struct {
+		name string
+		args map[string]any
+		want string
+	}{
+		{"defaults applied", map[string]any{}, "/repos/def/repo/contents/main.go?ref=develop"},
+		{"ref overridden", map[string]any{"github_ref": "v1.0"}, "/repos/def/repo/contents/main.go?ref=v1.0"},
+		{"repo overridden", map[string]any{"github_repo": "other/repo"}, "/repos/other/repo/contents/main.go"},
+		{"both overridden", map[string]any{"github_repo": "other/repo", "github_ref": "main"}, "/repos/other/repo/contents/main.go?ref=main"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			mu.Lock()
+			requested = nil
+			mu.Unlock()
+			provider := &mockProvider{}
+			s := &GeminiServer{
+				config: &Config{
+					Provider: ProviderConfig{Model: "test"}, HTTPTimeout: time.Second,
+					GitHubAPIBaseURL: server.URL, MaxGitHubFiles: 5, MaxGitHubFileSize: 1024,
+					DefaultGitHubRepo: "def/repo", DefaultGitHubRef: "develop",
+				},
+				provider:   provider,
+				httpClient: &http.Client{Timeout: 5 * time.Second},
+			}
+			args := map[string]any{"query": "review", "github_files": []any{"main.go"}}
+			for k, v := range tt.args {
+				args[k] = v
+			}
+			result, err := s.GeminiAskHandler(context.Background(), mcp.CallToolRequest{Params: mcp.CallToolParams{Arguments: args}})
+			require.NoError(t, err)
+			require.False(t, result.IsError, toolResultText(t, result))
+			mu.Lock()
+			assert.Equal(t, []string{tt.want}, requested)
+			mu.Unlock()
+		})
+	}
+}
+
+func TestGeminiAskHandlerGitHubTokenOverride(t *testing.T) {
+	const override = "ghp_per_request_secret"
+	var (
+		mu    sync.Mutex
+		auths []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		auths = append(auths, r.Header.Get("Authorization"))
+		mu.Unlock()
+		if strings.Contains(r.URL.Path, "/git/trees/") {
+			_, _ = io.WriteString(w, `{"tree":[{"path":"main.go","type":"blob"}]}`)
+			return
+		}
+		_, _ = io.WriteString(w, "package main")
+	}))
+	defer server.Close()
+
+	httpCtx := context.WithValue(context.Background(), httpMethodKey, "POST")
+	tests := []struct {
+		name      string
+		ctx       context.Context
+		args      map[string]any
+		wantAuth  string
+		wantError string
+	}{
+		{"stdio override", context.Background(), map[string]any{"github_token": override}, "token " + override, ""},
+		{"server token without override", context.Background(), map[string]any{}, "token server-token", ""},
+		{"authenticated http override", context.WithValue(httpCtx, authenticatedKey, true),
+			map[string]any{"github_token": override}, "token " + override, ""},
+		{"unauthenticated http rejected", httpCtx, map[string]any{"github_token": override}, "",
+			"'github_token' is only accepted on authenticated requests."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mu.Lock()
+			auths = nil
+			mu.Unlock()
+			logger := &captureLogger{}
+			ctx := context.WithValue(tt.ctx, loggerKey, Logger(logger))
+			s := &GeminiServer{
+				config: &Config{
+					Provider: ProviderConfig{Model: "test"}, HTTPTimeout: time.Second,
+					GitHubAPIBaseURL: server.URL, GitHubToken: "server-token",
+					MaxGitHubFiles: 5, MaxGitHubFileSize: 1024, MaxGitHubTreeEntries: 10,
+				},
+				provider:   &mockProvider{},
+				httpClient: &http.Client{Timeout: 5 * time.Second},
+			}
+			args := map[string]any{"query": "review", "github_repo": "o/r", "github_files": []any{"main.go"}, "github_tree": true}
+			for k, v := range tt.args {
+				args[k] = v
+			}
+			result, err := s.GeminiAskHandler(ctx, mcp.CallToolRequest{Params: mcp.CallToolParams{Arguments: args}})
+			require.NoError(t, err)
+			if tt.wantError != "" {
+				assert.True(t, result.IsError)
+				assert.Equal(t, tt.wantError, toolResultText(t, result))
+				mu.Lock()
+				assert.Empty(t, auths)
+				mu.Unlock()
+				return
+			}
+			require.False(t, result.IsError, toolResultText(t, result))
+			mu.Lock()
+			assert.Equal(t, []string{tt.wantAuth, tt.wantAuth}, auths)
+			mu.Unlock()
+			for _, e := range logger.snapshot() {
+				assert.NotContains(t, e.message, override)
+			}
+		})
+	}
+}
+
+func TestBuildToolResultResponseTemplate(t *testing.T) {
+	resp := &GenerationResponse{Text: "42", FinishReason: "stop", Model: "m1", Usage: UsageInfo{TotalTokens: 7}}
+	tests := []struct {
+		name, tmpl, want string
+	}{
+		{"unset", "", "42"},
+		{"applied", "<answer model={{.Model}} tokens={{.Usage.TotalTokens}}>{{.Answer}}</answer>", "<answer model=m1 tokens=7>42</answer>"},
+		{"runtime failure falls back", "{{.Missing}}", "42"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{}
+			if tt.tmpl != "" {
+				cfg.ResponseTemplate = template.Must(template.New("response").Parse(tt.tmpl))
+			}
+			s := &GeminiServer{config: cfg}
+			assert.Equal(t, tt.want, toolResultText(t, s.buildToolResult(context.Background(), GenerationRequest{}, s.config.Provider, resp, time.Second, NewLogger(LevelError))))
+		})
+	}
+}
+
+func TestBuildToolResultAppendMetadata(t *testing.T) {
+	resp := &GenerationResponse{Text: "42", FinishReason: "stop", Model: "m1", Usage: UsageInfo{TotalTokens: 1234}}
+	httpCtx := context.WithValue(context.Background(), httpMethodKey, "POST")
+	tests := []struct {
+		name    string
+		enabled bool
+		ctx     context.Context
+		want    string
+	}{
+		{"disabled", false, context.Background(), "42"},
+		{"stdio", true, context.Background(), "42\n\n[model=m1 tokens=1234 elapsed=3.2s]"},
+		{"http omitted", true, httpCtx, "42"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &GeminiServer{config: &Config{AppendMetadata: tt.enabled}}
+			result := s.buildToolResult(tt.ctx, GenerationRequest{}, s.config.Provider, resp, 3210*time.Millisecond, NewLogger(LevelError))
+			assert.Equal(t, tt.want, toolResultText(t, result))
+		})
+	}
+
+	t.Run("model falls back to served", func(t *testing.T) {
+		s := &GeminiServer{config: &Config{AppendMetadata: true}}
+		noModel := &GenerationResponse{Text: "42", FinishReason: "stop", Usage: UsageInfo{TotalTokens: 7}}
+		result := s.buildToolResult(context.Background(), GenerationRequest{}, ProviderConfig{Model: "qwen3.7-max"}, noModel, time.Second, NewLogger(LevelError))
+		assert.Equal(t, "42\n\n[model=qwen3.7-max tokens=7 elapsed=1s]", toolResultText(t, result))
+	})
+}
+
+func TestBuildToolResultResponseEnvelope(t *testing.T) {
+	tmpl := template.Must(template.New("r").Parse("templated {{.Answer}}"))
+	usage := UsageInfo{PromptTokens: 10, OutputTokens: 5, ReasoningTokens: 2, CachedTokens: 3, TotalTokens: 15}
+	tests := []struct {
+		name string
+		resp *GenerationResponse
+		want string
+	}{
+		{
+			"answer with usage",
+			&GenerationResponse{Text: "42", FinishReason: "stop", Model: "m1", Usage: usage},
+			`{"answer":"42","usage":{"prompt_tokens":10,"output_tokens":5,"reasoning_tokens":2,"cached_tokens":3,"total_tokens":15},"model_used":"m1","finish_reason":"stop"}`,
+		},
+		{
+			"model falls back to configured",
+			&GenerationResponse{Text: "hi", FinishReason: "stop"},
+			`{"answer":"hi","usage":{"prompt_tokens":0,"output_tokens":0,"reasoning_tokens":0,"cached_tokens":0,"total_tokens":0},"model_used":"deepseek-v4-pro","finish_reason":"stop"}`,
+		},
+		{
+			"truncated answer stays raw",
+			&GenerationResponse{Text: "partial", FinishReason: "length", Model: "m1"},
+			`{"answer":"partial","usage":{"prompt_tokens":0,"output_tokens":0,"reasoning_tokens":0,"cached_tokens":0,"total_tokens":0},"model_used":"m1","finish_reason":"length","truncated":true}`,
+		},
+		{
+			"empty answer has no placeholder",
+			&GenerationResponse{Text: "", FinishReason: "content_filter", Model: "m1"},
+			`{"answer":"","usage":{"prompt_tokens":0,"output_tokens":0,"reasoning_tokens":0,"cached_tokens":0,"total_tokens":0},"model_used":"m1","finish_reason":"content_filter"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &GeminiServer{config: &Config{
+				Provider:         ProviderConfig{Model: "deepseek-v4-pro"},
+				ResponseEnvelope: true, ResponseTemplate: tmpl, AppendMetadata: true,
+			}}
+			result := s.buildToolResult(context.Background(), GenerationRequest{}, s.config.Provider, tt.resp, time.Second, NewLogger(LevelError))
+			assert.JSONEq(t, tt.want, toolResultText(t, result))
+		})
+	}
+
+	t.Run("via handler", func(t *testing.T) {
+		s := &GeminiServer{
+			config: &Config{Provider: ProviderConfig{Model: "test"}, HTTPTimeout: time.Second, ResponseEnvelope: true},
+			provider: &mockProvider{generateFn: func(context.Context, GenerationRequest) (*GenerationResponse, error) {
+				return &GenerationResponse{Text: "line1\n\"quoted\"", FinishReason: "stop", Model: "m2"}, nil
+			}},
+		}
+		req := mcp.CallToolRequest{Params: mcp.CallToolParams{Arguments: map[string]any{"query": "hello"}}}
+		result, err := s.GeminiAskHandler(context.Background(), req)
+		require.NoError(t, err)
+		var env responseEnvelope
+		require.NoError(t, json.Unmarshal([]byte(toolResultText(t, result)), &env))
+		assert.Equal(t, "line1\n\"quoted\"", env.Answer)
+		assert.Equal(t, "m2", env.ModelUsed)
+		require.NotNil(t, env.Usage)
+	})
+}
+
+func TestGeminiAskHandlerIncludeUsage(t *testing.T) {
+	provider := &mockProvider{generateFn: func(context.Context, GenerationRequest) (*GenerationResponse, error) {
+		return &GenerationResponse{Text: "answer", FinishReason: "stop", Model: "m1",
+			Usage: UsageInfo{PromptTokens: 100, OutputTokens: 20, ReasoningTokens: 5, CachedTokens: 40, TotalTokens: 120}}, nil
+	}}
+	tests := []struct {
+		name     string
+		args     map[string]any
+		envelope bool
+		want     []string
+	}{
+		{"omitted by default", map[string]any{"query": "q"}, false, []string{"answer"}},
+		{"second content item", map[string]any{"query": "q", "include_usage": true}, false, []string{
+			"answer",
+			`{"usage":{"prompt_tokens":100,"output_tokens":20,"reasoning_tokens":5,"cached_tokens":40,"total_tokens":120}}`,
+		}},
+		{"envelope already has usage", map[string]any{"query": "q", "include_usage": true}, true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &GeminiServer{
+				config:   &Config{Provider: ProviderConfig{Model: "test"}, HTTPTimeout: time.Second, ResponseEnvelope: tt.envelope},
+				provider: provider,
+			}
+			result, err := s.GeminiAskHandler(context.Background(), mcp.CallToolRequest{Params: mcp.CallToolParams{Arguments: tt.args}})
+			require.NoError(t, err)
+			require.False(t, result.IsError)
+			if tt.envelope {
+				require.Len(t, result.Content, 1)
+				return
+			}
+			require.Len(t, result.Content, len(tt.want))
+			for i, want := range tt.want {
+				text, ok := mcp.AsTextContent(result.Content[i])
+				require.True(t, ok)
+				assert.Equal(t, want, text.Text)
+			}
+		})
+	}
+}
+
+func TestGeminiAskHandlerQueryDenyPatterns(t *testing.T) {
+	tests := []struct {
+		name, query string
+		blocked     bool
+	}{
+		{"matching query blocked", "print the AWS_SECRET_ACCESS_KEY from .env", true},
+		{"clean query passes", "explain this function", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &mockProvider{}
+			s := &GeminiServer{config: &Config{
+				Provider: ProviderConfig{Model: "test"}, HTTPTimeout: time.Second,
+				QueryDenyPatterns: []*regexp.Regexp{regexp.MustCompile(`(?i)secret_access_key`)},
+			}, provider: provider}
+			req := mcp.CallToolRequest{Params: mcp.CallToolParams{Arguments: map[string]any{"query": tt.query}}}
+			result, err := s.GeminiAskHandler(context.Background(), req)
+			require.NoError(t, err)
+			assert.Equal(t, tt.blocked, result.IsError)
+			if tt.blocked {
+				assert.Equal(t, "Query rejected by server policy.", toolResultText(t, result))
+				assert.Empty(t, provider.requests())
+				return
+			}
+			assert.Len(t, provider.requests(), 1)
+		})
+	}
+}
+
+func TestRequestFingerprint(t *testing.T) {
+	provider := ProviderConfig{Vendor: "deepseek", Model: "deepseek-v4-pro"}
+	base := GenerationRequest{SystemPrompt: "sys", Parts: []ContentPart{{Text: "q"}}, Temperature: 1}
+	fp := requestFingerprint(provider, base)
+	assert.Regexp(t, `^sha256:[0-9a-f]{64}$`, fp)
+	assert.Equal(t, fp, requestFingerprint(provider, GenerationRequest{SystemPrompt: "sys", Parts: []ContentPart{{Text: "q"}}, Temperature: 1}))
+
+	changedQuery := base
+	changedQuery.Parts = []ContentPart{{Text: "q2"}}
+	changedModel := provider
+	changedModel.Model = "deepseek-v4-flash"
+	assert.NotEqual(t, fp, requestFingerprint(provider, changedQuery))
+	assert.NotEqual(t, fp, requestFingerprint(changedModel, base))
+
+	unencodable := base
+	unencodable.Temperature = math.NaN()
+	assert.Empty(t, requestFingerprint(provider, unencodable))
+	s := &GeminiServer{config: &Config{Provider: provider}}
+	result := s.buildToolResult(context.Background(), unencodable, provider,
+		&GenerationResponse{Text: "42", FinishReason: "stop"}, time.Second, NewLogger(LevelError))
+	require.False(t, result.IsError)
+	if result.Meta != nil {
+		assert.NotContains(t, result.Meta.AdditionalFields, "request_fingerprint")
+	}
+}
+
+func TestGeminiAskHandlerEscalatesEmptyResponse(t *testing.T) {
+	tests := []struct {
+		name         string
+		finish       string
+		escalatorErr error
+		wantText     string
+		wantCalls    int
+	}{
+		{"empty answer escalates", "stop", nil, "from pro", 1},
+		{"content filter does not escalate", "content_filter", nil, "[WARN finish_reason=content_filter]", 0},
+		{"failed escalation keeps original", "stop", errors.New("down"), "The model returned an empty response", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &mockProvider{generateFn: func(context.Context, GenerationRequest) (*GenerationResponse, error) {
+				return &GenerationResponse{FinishReason: tt.finish, Model: "deepseek-v4-flash"}, nil
+			}}
+			escalator := &mockProvider{generateFn: func(context.Context, GenerationRequest) (*GenerationResponse, error) {
+				if tt.escalatorErr != nil {
+					return nil, tt.escalatorErr
+				}
+				return &GenerationResponse{Text: "from pro", FinishReason: "stop", Model: "deepseek-v4-pro"}, nil
+			}}
+			s := &GeminiServer{
+				config:    &Config{Provider: ProviderConfig{Model: "deepseek-v4-flash"}, HTTPTimeout: time.Second, EscalateOnEmpty: true},
+				provider:  provider,
+				escalator: escalator,
+			}
+			req := mcp.CallToolRequest{Params: mcp.CallToolParams{Arguments: map[string]any{"query": "hello"}}}
+			result, err := s.GeminiAskHandler(context.Background(), req)
+			require.NoError(t, err)
+			assert.Contains(t, toolResultText(t, result), tt.wantText)
+			require.Len(t, escalator.requests(), tt.wantCalls)
+			if tt.wantCalls > 0 {
+				assert.Equal(t, provider.requests()[0], escalator.requests()[0], "escalation must resend the same request")
+			}
+			if tt.wantText == "from pro" {
+				assert.Equal(t, "deepseek-v4-pro", result.Meta.AdditionalFields["model_used"])
+				assert.Equal(t, requestFingerprint(ProviderConfig{Model: "deepseek-v4-pro"}, escalator.requests()[0]),
+					result.Meta.AdditionalFields["request_fingerprint"], "fingerprint must name the escalated model")
+			}
+		})
+	}
+}
+
+func TestGeminiAskHandlerFailover(t *testing.T) {
+	transient := errors.New("503 service unavailable")
+	tests := []struct {
+		name         string
+		primaryErr   error
+		wantFailover bool
+		wantText     string
+	}{
+		{"transient primary failure fails over", transient, true, "from secondary"},
+		{"client error does not fail over", errors.New("400 bad request"), false, "Error from provider API"},
+		{"primary success", nil, false, "from primary"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			primary := &mockProvider{
+				generateFn: func(context.Context, GenerationRequest) (*GenerationResponse, error) {
+					if tt.primaryErr != nil {
+						return nil, tt.primaryErr
+					}
+					return &GenerationResponse{Text: "from primary", FinishReason: "stop"}, nil
+				},
+				retryableFn: func(err error) bool { return errors.Is(err, transient) },
+			}
+			secondary := &mockProvider{generateFn: func(context.Context, GenerationRequest) (*GenerationResponse, error) {
+				return &GenerationResponse{Text: "from secondary", FinishReason: "stop", Model: "qwen3.7-max"}, nil
+			}}
+			s := &GeminiServer{
+				config: &Config{
+					Provider:         ProviderConfig{Vendor: "deepseek", Model: "deepseek-v4-pro"},
+					FailoverProvider: &ProviderConfig{Vendor: "qwen", Model: "qwen3.7-max"},
+					HTTPTimeout:      time.Second,
+					TraceDir:         t.TempDir(),
+				},
+				provider: primary,
+				failover: secondary,
+			}
+			req := mcp.CallToolRequest{Params: mcp.CallToolParams{Arguments: map[string]any{"query": "hello"}}}
+			result, err := s.processWithFiles(context.Background(), req, "hello", nil, nil, nil, "", categoryGeneral, "")
+			require.NoError(t, err)
+			assert.Contains(t, toolResultText(t, result), tt.wantText)
+			if tt.wantFailover {
+				require.Len(t, secondary.requests(), 1)
+				assert.Equal(t, primary.requests()[0], secondary.requests()[0], "failover must resend the same request")
+				assert.Equal(t, "qwen3.7-max", result.Meta.AdditionalFields["model_used"])
+				assert.Equal(t, requestFingerprint(*s.config.FailoverProvider, secondary.requests()[0]),
+					result.Meta.AdditionalFields["request_fingerprint"], "fingerprint must name the provider that answered")
+				entries, err := os.ReadDir(s.config.TraceDir)
+				require.NoError(t, err)
+				require.Len(t, entries, 1)
+				data, err := os.ReadFile(filepath.Join(s.config.TraceDir, entries[0].Name()))
+				require.NoError(t, err)
+				var record traceRecord
+				require.NoError(t, json.Unmarshal(data, &record))
+				assert.Equal(t, "qwen", record.Vendor)
+				assert.Equal(t, result.Meta.AdditionalFields["request_fingerprint"], record.Fingerprint)
+			} else {
+				assert.Empty(t, secondary.requests())
+			}
+		})
+	}
+}
+
+func TestGeminiAskHandlerFailoverEscalatesEmptyResponse(t *testing.T) {
+	transient := errors.New("503 service unavailable")
+	primary := &mockProvider{
+		generateFn:  func(context.Context, GenerationRequest) (*GenerationResponse, error) { return nil, transient },
+		retryableFn: func(err error) bool { return errors.Is(err, transient) },
+	}
+	secondary := &mockProvider{generateFn: func(context.Context, GenerationRequest) (*GenerationResponse, error) {
+		return &GenerationResponse{FinishReason: "stop", Model: "qwen3.7-plus"}, nil
+	}}
+	primaryEscalator := &mockProvider{}
+	secondaryEscalator := &mockProvider{generateFn: func(context.Context, GenerationRequest) (*GenerationResponse, error) {
+		return &GenerationResponse{Text: "from max", FinishReason: "stop", Model: "qwen3.7-max"}, nil
+	}}
+	s := &GeminiServer{
+		config: &Config{
+			Provider:         ProviderConfig{Vendor: "deepseek", Model: "deepseek-v4-flash"},
+			FailoverProvider: &ProviderConfig{Vendor: "qwen", Model: "qwen3.7-plus"},
+			HTTPTimeout:      time.Second, EscalateOnEmpty: true,
+		},
+		provider:          primary,
+		escalator:         primaryEscalator,
+		failover:          secondary,
+		failoverEscalator: secondaryEscalator,
+	}
+	req := mcp.CallToolRequest{Params: mcp.CallToolParams{Arguments: map[string]any{"query": "hello"}}}
+	result, err := s.GeminiAskHandler(context.Background(), req)
+	require.NoError(t, err)
+	assert.Contains(t, toolResultText(t, result), "from max")
+	assert.Empty(t, primaryEscalator.requests(), "the primary's escalator must not serve a failover answer")
+	require.Len(t, secondaryEscalator.requests(), 1)
+	assert.Equal(t, secondary.requests()[0], secondaryEscalator.requests()[0])
+}
+
+func TestGeminiAskHandlerIncludeReadme(t *testing.T) {
+	var readmeCalls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/o/r/readme":
+			readmeCalls.Add(1)
+			assert.Equal(t, "dev", r.URL.Query().Get("ref"))
+			_, _ = io.WriteString(w, `{"path":"README.md","size":8,"encoding":"base64","content":"IyBUaXRs\nZQo=\n"}`)
+		case "/repos/o/r/contents/main.go":
+			_, _ = io.WriteString(w, "package main")
+		case "/repos/o/r/contents/util.go":
+			_, _ = io.WriteString(w, "package util")
+		case "/repos/o/r/git/trees/dev":
+			_, _ = io.WriteString(w, `{"tree":[{"path":"main.go","type":"blob"}]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name        string
+		autoInclude bool
+		totalBytes  int64
+		treeOnly    bool
+		args        map[string]any
+		wantReadme  bool
+	}{
+		{name: "tree only", treeOnly: true, args: map[string]any{"include_readme": true}, wantReadme: true},
+		{
+			name: "stays first despite file_priority",
+			args: map[string]any{
+				"include_readme": true,
+				"github_files":   []any{"main.go", "util.go"},
+				"file_priority":  map[string]any{"main.go": 10, "util.go": 5},
+			},
+			wantReadme: true,
+		},
+		{name: "argument enables", args: map[string]any{"include_readme": true}, wantReadme: true},
+		{name: "disabled by default", args: map[string]any{}},
+		{name: "env default enables", autoInclude: true, args: map[string]any{}, wantReadme: true},
+		{name: "argument overrides env default", autoInclude: true, args: map[string]any{"include_readme": false}},
+		{name: "skipped over total bytes", totalBytes: 16, args: map[string]any{"include_readme": true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			readmeCalls.Store(0)
+			provider := &mockProvider{}
+			s := &GeminiServer{
+				config: &Config{
+					Provider: ProviderConfig{Model: "test"}, HTTPTimeout: time.Second,
+					GitHubAPIBaseURL: server.URL, MaxGitHubFiles: 5, MaxGitHubFileSize: 1024,
+					MaxGitHubTotalBytes: tt.totalBytes, AutoIncludeReadme: tt.autoInclude,
+				},
+				provider:   provider,
+				httpClient: &http.Client{Timeout: 5 * time.Second},
+			}
+			args := map[string]any{"query": "review", "github_repo": "o/r", "github_ref": "dev", "github_files": []any{"main.go"}}
+			if tt.treeOnly {
+				delete(args, "github_files")
+				args["github_tree"] = true
+			}
+			for k, v := range tt.args {
+				args[k] = v
+			}
+			result, err := s.GeminiAskHandler(context.Background(), mcp.CallToolRequest{Params: mcp.CallToolParams{Arguments: args}})
+			require.NoError(t, err)
+			require.False(t, result.IsError, toolResultText(t, result))
+
+			requests := provider.requests()
+			require.Len(t, requests, 1)
+			var prompt strings.Builder
+			for _, p := range requests[0].Parts {
+				prompt.WriteString(p.Text)
+			}
+			if !tt.wantReadme {
+				assert.NotContains(t, prompt.String(), "# Title")
+				if tt.totalBytes == 0 {
+					assert.Zero(t, readmeCalls.Load())
+				}
+				return
+			}
+			assert.Equal(t, int32(1), readmeCalls.Load())
+			files, _ := args["github_files"].([]any)
+			inventory := prompt.String() + requests[0].SystemPrompt
+			assert.Contains(t, inventory, fmt.Sprintf("- %d <file> element(s) at ref dev", len(files)+1), "the README must be counted")
+			readmeAt := strings.Index(prompt.String(), "# Title")
+			require.GreaterOrEqual(t, readmeAt, 0)
+			if !tt.treeOnly {
+				assert.Less(t, readmeAt, strings.Index(prompt.String(), "package main"), "README must come first")
+			}
 		})
 	}
 }
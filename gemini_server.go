@@ -23,10 +23,33 @@ func NewGeminiServer(ctx context.Context, config *Config) (*GeminiServer, error)
 		return nil, fmt.Errorf("failed to create prequalify provider: %w", err)
 	}
 
+	escalator, err := NewEscalationProvider(config, getLoggerFromContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create escalation provider: %w", err)
+	}
+
+	failover, err := NewFailoverProvider(config, getLoggerFromContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create failover provider: %w", err)
+	}
+
+	var failoverEscalator Provider
+	if config.FailoverProvider != nil {
+		fcfg := *config
+		fcfg.Provider = *config.FailoverProvider
+		if failoverEscalator, err = NewEscalationProvider(&fcfg, getLoggerFromContext(ctx)); err != nil {
+			return nil, fmt.Errorf("failed to create failover escalation provider: %w", err)
+		}
+	}
+
 	return &GeminiServer{
 		config:       config,
 		provider:     provider,
 		prequalifier: prequalifier,
-		httpClient:   &http.Client{Timeout: config.HTTPTimeout},
+		escalator:    escalator,
+		failover:     failover,
+
+		failoverEscalator: failoverEscalator,
+		httpClient:        &http.Client{Timeout: config.HTTPTimeout},
 	}, nil
 }
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// toolCallStats counts tool calls across the process for gemini_status.
+// wrapHandlerWithLogger brackets every tool call with begin/end.
+type toolCallStats struct {
+	started time.Time
+	active  atomic.Int64 // calls currently in flight
+	total   atomic.Int64 // calls completed since start
+}
+
+var callStats = &toolCallStats{started: time.Now()}
+
+func (c *toolCallStats) begin() { c.active.Add(1) }
+
+func (c *toolCallStats) end() {
+	c.active.Add(-1)
+	c.total.Add(1)
+}
+
+// serverStatus is the gemini_status result document.
+type serverStatus struct {
+	ActiveRequests int64  `json:"active_requests"` // includes this gemini_status call
+	TotalRequests  int64  `json:"total_requests"`
+	UptimeSeconds  int64  `json:"uptime_seconds"`
+	Vendor         string `json:"vendor"`
+	Model          string `json:"model"`
+	FailoverVendor string `json:"failover_vendor,omitempty"`
+	FailoverModel  string `json:"failover_model,omitempty"`
+}
+
+// GeminiStatusHandler reports current load and the configured provider, so
+// operators can check a server without metrics infrastructure.
+func (s *GeminiServer) GeminiStatusHandler(ctx context.Context, _ mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	status := serverStatus{
+		ActiveRequests: callStats.active.Load(),
+		TotalRequests:  callStats.total.Load(),
+		UptimeSeconds:  int64(time.Since(callStats.started).Seconds()),
+		Vendor:         s.config.Provider.Vendor,
+		Model:          s.config.ActiveModel(),
+	}
+	if fo := s.config.FailoverProvider; fo != nil {
+		status.FailoverVendor, status.FailoverModel = fo.Vendor, fo.Model
+	}
+	data, err := json.Marshal(status)
+	if err != nil {
+		return createErrorResult(fmt.Sprintf("failed to encode status: %v", err)), nil
+	}
+	return &mcp.CallToolResult{Content: []mcp.Content{mcp.NewTextContent(string(data))}}, nil
+}
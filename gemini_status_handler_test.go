@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGeminiStatusReflectsInFlightRequests(t *testing.T) {
+	s := &GeminiServer{config: &Config{
+		Provider:         ProviderConfig{Vendor: "deepseek", Model: "deepseek-v4-pro"},
+		FailoverProvider: &ProviderConfig{Vendor: "qwen", Model: "qwen3.7-max"},
+	}}
+	logger := NewLogger(LevelError)
+	status := wrapHandlerWithLogger(s.GeminiStatusHandler, "gemini_status", logger)
+	readStatus := func() serverStatus {
+		result, err := status(context.Background(), mcp.CallToolRequest{})
+		require.NoError(t, err)
+		var st serverStatus
+		require.NoError(t, json.Unmarshal([]byte(toolResultText(t, result)), &st))
+		return st
+	}
+
+	baseline := readStatus()
+	assert.Equal(t, int64(1), baseline.ActiveRequests, "the status call counts itself")
+	assert.Equal(t, "deepseek", baseline.Vendor)
+	assert.Equal(t, "deepseek-v4-pro", baseline.Model)
+	assert.Equal(t, "qwen", baseline.FailoverVendor)
+	assert.Equal(t, "qwen3.7-max", baseline.FailoverModel)
+
+	const inFlight = 3
+	release := make(chan struct{})
+	var started, done sync.WaitGroup
+	started.Add(inFlight)
+	done.Add(inFlight)
+	blocking := wrapHandlerWithLogger(func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		started.Done()
+		<-release
+		return &mcp.CallToolResult{}, nil
+	}, "blocking", logger)
+	for range inFlight {
+		go func() {
+			defer done.Done()
+			_, _ = blocking(context.Background(), mcp.CallToolRequest{})
+		}()
+	}
+	started.Wait()
+
+	during := readStatus()
+	assert.Equal(t, baseline.ActiveRequests+inFlight, during.ActiveRequests)
+	assert.Equal(t, baseline.TotalRequests+1, during.TotalRequests, "only the first status call has completed")
+
+	close(release)
+	done.Wait()
+	after := readStatus()
+	assert.Equal(t, baseline.ActiveRequests, after.ActiveRequests)
+	assert.Equal(t, baseline.TotalRequests+1+inFlight+1, after.TotalRequests)
+}
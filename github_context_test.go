@@ -1,17 +1,26 @@
 package main
 
 import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestParseGitHubContextSpec(t *testing.T) {
 	req := mcp.CallToolRequest{Params: mcp.CallToolParams{Arguments: map[string]any{
 		"github_pr": float64(42), "github_commits": []any{"a", "b"}, "github_diff_base": "main", "github_diff_head": "feature",
+		"github_tree": true,
 	}}}
 	spec := parseGitHubContextSpec(req)
+	assert.True(t, spec.tree)
 	assert.True(t, spec.hasPR)
 	assert.Equal(t, 42, spec.prNumber)
 	assert.Equal(t, []string{"a", "b"}, spec.commits)
@@ -24,3 +33,103 @@ func TestConsolidatedContextError(t *testing.T) {
 	assert.True(t, result.IsError)
 	assert.Contains(t, toolResultText(t, result), "Failed to fetch any")
 }
+
+func TestGatherTree(t *testing.T) {
+	var gotURI string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotURI = r.URL.RequestURI()
+		_, _ = io.WriteString(w, `{"sha":"abc","truncated":false,"tree":[
+			{"path":"README.md","type":"blob"},
+			{"path":"cmd","type":"tree"},
+			{"path":"cmd/app","type":"tree"},
+			{"path":"cmd/app/main.go","type":"blob"},
+			{"path":"vendor-lib","type":"commit"}
+		]}`)
+	}))
+	defer server.Close()
+
+	newServer := func(maxEntries int) *GeminiServer {
+		return &GeminiServer{
+			config:     &Config{GitHubAPIBaseURL: server.URL, MaxGitHubTreeEntries: maxEntries},
+			httpClient: &http.Client{Timeout: 5 * time.Second},
+		}
+	}
+
+	t.Run("renders indented tree", func(t *testing.T) {
+		parts, inv, err := newServer(100).gatherTree(context.Background(), "o", "r", "feature/x")
+		require.NoError(t, err)
+		assert.Equal(t, "/repos/o/r/git/trees/feature/x?recursive=1", gotURI)
+		require.Len(t, parts, 1)
+		assert.Equal(t, "  <tree ref=\"feature/x\" entries=\"5\" truncated=\"false\">\n"+
+			"    README.md\n"+
+			"    cmd/\n"+
+			"      app/\n"+
+			"        main.go\n"+
+			"    vendor-lib (submodule)\n"+
+			"  </tree>\n", parts[0].Text)
+		assert.Equal(t, &treeInventory{Ref: "feature/x", Entries: 5}, inv)
+	})
+
+	t.Run("empty ref uses HEAD", func(t *testing.T) {
+		_, _, err := newServer(100).gatherTree(context.Background(), "o", "r", "")
+		require.NoError(t, err)
+		assert.Equal(t, "/repos/o/r/git/trees/HEAD?recursive=1", gotURI)
+	})
+
+	t.Run("caps entries", func(t *testing.T) {
+		parts, inv, err := newServer(2).gatherTree(context.Background(), "o", "r", "main")
+		require.NoError(t, err)
+		assert.Contains(t, parts[0].Text, `entries="2" truncated="true"`)
+		assert.NotContains(t, parts[0].Text, "main.go")
+		assert.Equal(t, &treeInventory{Ref: "main", Entries: 2, Truncated: true}, inv)
+	})
+
+	t.Run("escapes entry names", func(t *testing.T) {
+		hostile := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, `{"tree":[{"path":"a&b<tree>.md","type":"blob"}]}`)
+		}))
+		defer hostile.Close()
+		s := &GeminiServer{
+			config:     &Config{GitHubAPIBaseURL: hostile.URL, MaxGitHubTreeEntries: 10},
+			httpClient: &http.Client{Timeout: 5 * time.Second},
+		}
+		parts, _, err := s.gatherTree(context.Background(), "o", "r", "main")
+		require.NoError(t, err)
+		assert.Contains(t, parts[0].Text, "    a&amp;b&lt;tree&gt;.md\n")
+	})
+}
+
+func TestGeminiAskHandlerGitHubTree(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/o/r/git/trees/main" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = io.WriteString(w, `{"tree":[{"path":"go.mod","type":"blob"}],"truncated":true}`)
+	}))
+	defer server.Close()
+
+	provider := &mockProvider{}
+	s := &GeminiServer{
+		config: &Config{
+			Provider: ProviderConfig{Model: "test"}, HTTPTimeout: time.Second,
+			GitHubAPIBaseURL: server.URL, MaxGitHubTreeEntries: 10,
+		},
+		provider:   provider,
+		httpClient: &http.Client{Timeout: 5 * time.Second},
+	}
+	req := mcp.CallToolRequest{Params: mcp.CallToolParams{Arguments: map[string]any{
+		"query": "explain the layout", "github_repo": "o/r", "github_ref": "main", "github_tree": true,
+	}}}
+	result, err := s.GeminiAskHandler(context.Background(), req)
+	require.NoError(t, err)
+	require.False(t, result.IsError, toolResultText(t, result))
+
+	sent := provider.requests()[0]
+	var body strings.Builder
+	for _, p := range sent.Parts {
+		body.WriteString(p.Text)
+	}
+	assert.Contains(t, body.String(), "<tree ref=\"main\" entries=\"1\" truncated=\"true\">\n    go.mod\n  </tree>")
+	assert.Contains(t, sent.SystemPrompt, "- A <tree> element listing 1 path(s) at main (listing was truncated)")
+}
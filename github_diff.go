@@ -129,6 +129,16 @@ func githubAPIGet(ctx context.Context, s *GeminiServer, url, accept string, maxB
 	})
 }
 
+// githubToken returns the GitHub token for the current request: the
+// caller's github_token argument when GeminiAskHandler accepted one, else
+// GEMINI_GITHUB_TOKEN. The value must never be logged.
+func (s *GeminiServer) githubToken(ctx context.Context) string {
+	if token, ok := ctx.Value(githubTokenKey).(string); ok && token != "" {
+		return token
+	}
+	return s.config.GitHubToken
+}
+
 // githubAPIGetOnce issues a single GET attempt and classifies the response.
 // It is split out so githubAPIGet's retry wrapper stays trivial.
 func githubAPIGetOnce(
@@ -142,8 +152,8 @@ func githubAPIGetOnce(
 	if accept != "" {
 		req.Header.Set("Accept", accept)
 	}
-	if s.config.GitHubToken != "" {
-		req.Header.Set("Authorization", "token "+s.config.GitHubToken)
+	if token := s.githubToken(ctx); token != "" {
+		req.Header.Set("Authorization", "token "+token)
 	}
 	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
 
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// githubReadme is the slice of /repos/.../readme we use.
+type githubReadme struct {
+	Path     string `json:"path"`
+	Size     int64  `json:"size"`
+	Encoding string `json:"encoding"`
+	Content  string `json:"content"`
+}
+
+// fetchReadme fetches the repository README at ref. GitHub's readme endpoint
+// picks the preferred variant itself (README.md, README.rst, README, ...),
+// so a single call covers every common name.
+func (s *GeminiServer) fetchReadme(ctx context.Context, owner, repo, ref string) (*FileUploadRequest, error) {
+	readmeURL := fmt.Sprintf("%s/repos/%s/%s/readme", strings.TrimRight(s.config.GitHubAPIBaseURL, "/"), owner, repo)
+	if ref != "" {
+		readmeURL += "?ref=" + url.QueryEscape(ref)
+	}
+	// Base64 inflates the body by 4/3; leave headroom for the JSON envelope.
+	body, err := githubAPIGet(ctx, s, readmeURL, "application/vnd.github+json", 2*s.config.MaxGitHubFileSize+64<<10)
+	if err != nil {
+		return nil, err
+	}
+	var readme githubReadme
+	if err := json.Unmarshal(body, &readme); err != nil {
+		return nil, fmt.Errorf("failed to parse readme response: %w", err)
+	}
+	if readme.Size > s.config.MaxGitHubFileSize {
+		return nil, fmt.Errorf("%s is %d bytes, above GEMINI_MAX_GITHUB_FILE_SIZE (%d)", readme.Path, readme.Size, s.config.MaxGitHubFileSize)
+	}
+	if readme.Encoding != "base64" {
+		return nil, fmt.Errorf("unsupported readme encoding %q", readme.Encoding)
+	}
+	content, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(readme.Content, "\n", ""))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode readme content: %w", err)
+	}
+	return &FileUploadRequest{
+		FileName: readme.Path,
+		MimeType: getMimeTypeFromPath(readme.Path),
+		Content:  content,
+	}, nil
+}
+
+// prependReadme adds the repository README in front of uploads for
+// include_readme, pinned there so file_priority cannot move it. requested is
+// the number of github_files paths. It stays within the github_files limits:
+// the README is skipped (with a warning) when it would exceed
+// GEMINI_MAX_GITHUB_FILES or GEMINI_MAX_GITHUB_TOTAL_BYTES, and is not
+// duplicated when the caller already listed it.
+func (s *GeminiServer) prependReadme(
+	ctx context.Context, repoStr, ref string, uploads []*FileUploadRequest, requested int,
+) ([]*FileUploadRequest, []string) {
+	logger := getLoggerFromContext(ctx)
+	if requested >= s.config.MaxGitHubFiles {
+		return uploads, []string{fmt.Sprintf("include_readme: skipped, github_files already at the limit of %d files", s.config.MaxGitHubFiles)}
+	}
+	owner, repo, err := parseGitHubRepo(repoStr)
+	if err != nil {
+		return uploads, []string{fmt.Sprintf("include_readme: %v", err)}
+	}
+	readme, err := s.fetchReadme(ctx, owner, repo, ref)
+	if err != nil {
+		logger.Warn("README fetch failed for %s/%s: %v", owner, repo, err)
+		return uploads, []string{fmt.Sprintf("include_readme: %v", err)}
+	}
+
+	total := int64(len(readme.Content))
+	for _, u := range uploads {
+		if strings.EqualFold(u.FileName, readme.FileName) {
+			return uploads, nil
+		}
+		total += int64(len(u.Content))
+	}
+	if s.config.MaxGitHubTotalBytes > 0 && total > s.config.MaxGitHubTotalBytes {
+		return uploads, []string{fmt.Sprintf("include_readme: skipped, %s would exceed GEMINI_MAX_GITHUB_TOTAL_BYTES (%d)",
+			readme.FileName, s.config.MaxGitHubTotalBytes)}
+	}
+	logger.Info("Prepending %s (%d bytes) for include_readme", readme.FileName, len(readme.Content))
+	readme.pinned = true
+	return append([]*FileUploadRequest{readme}, uploads...), nil
+}
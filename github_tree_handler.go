@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// maxGitHubTreeBytes caps the raw git/trees response. GitHub itself stops at
+// 100,000 entries / 7 MB and sets truncated, so this only guards against a
+// misbehaving Enterprise host.
+const maxGitHubTreeBytes = 8 << 20
+
+// githubTree is the slice of /repos/.../git/trees/{ref}?recursive=1 we use.
+type githubTree struct {
+	Tree []struct {
+		Path string `json:"path"`
+		Type string `json:"type"` // "blob", "tree" or "commit" (submodule)
+	} `json:"tree"`
+	Truncated bool `json:"truncated"`
+}
+
+// gatherTree fetches the recursive directory listing of owner/repo at ref and
+// renders it as a single indented <tree> part. No file bodies are downloaded.
+// At most MaxGitHubTreeEntries entries are listed; the part and inventory are
+// marked truncated when the cap or GitHub's own limit cut the listing short.
+func (s *GeminiServer) gatherTree(
+	ctx context.Context, owner, repo, ref string,
+) ([]ContentPart, *treeInventory, error) {
+	logger := getLoggerFromContext(ctx)
+	logger.Info("Fetching GitHub tree %s/%s@%s", owner, repo, ref)
+
+	treeRef := ref
+	if treeRef == "" {
+		treeRef = "HEAD"
+	}
+	apiBase := strings.TrimRight(s.config.GitHubAPIBaseURL, "/")
+	treeURL := fmt.Sprintf("%s/repos/%s/%s/git/trees/%s?recursive=1", apiBase, owner, repo, encodeRefForURL(treeRef))
+
+	body, err := githubAPIGet(ctx, s, treeURL, "application/vnd.github+json", maxGitHubTreeBytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	var tree githubTree
+	if err := json.Unmarshal(body, &tree); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse tree listing: %w", err)
+	}
+
+	entries := tree.Tree
+	truncated := tree.Truncated
+	if limit := s.config.MaxGitHubTreeEntries; limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+		truncated = true
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "  <tree ref=\"%s\" entries=\"%d\" truncated=\"%s\">\n", xmlAttr(ref), len(entries), boolStr(truncated))
+	for _, e := range entries {
+		depth := strings.Count(e.Path, "/")
+		name := path.Base(e.Path)
+		switch e.Type {
+		case "tree":
+			name += "/"
+		case "commit":
+			name += " (submodule)"
+		}
+		fmt.Fprintf(&b, "%s%s\n", strings.Repeat("  ", depth+2), xmlText(name))
+	}
+	b.WriteString("  </tree>\n")
+
+	inv := &treeInventory{Ref: ref, Entries: len(entries), Truncated: truncated}
+	return []ContentPart{{Text: b.String()}}, inv, nil
+}
@@ -2,11 +2,15 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"path"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/mark3labs/mcp-go/mcp"
 )
@@ -87,6 +91,35 @@ func extractArgumentStringArray(req mcp.CallToolRequest, name string) []string {
 	return result
 }
 
+// extractArgumentIntMap extracts a string→int object argument from the request
+// parameters. Like extractArgumentStringArray it tolerates clients that send
+// the object as a JSON string. Non-numeric values are skipped.
+func extractArgumentIntMap(req mcp.CallToolRequest, name string) map[string]int {
+	args := req.GetArguments()
+	raw, ok := args[name].(map[string]any)
+	if !ok {
+		s, isString := args[name].(string)
+		if !isString || !strings.HasPrefix(strings.TrimSpace(s), "{") {
+			return nil
+		}
+		if err := json.Unmarshal([]byte(s), &raw); err != nil {
+			return nil
+		}
+	}
+	result := make(map[string]int, len(raw))
+	for key, val := range raw {
+		switch v := val.(type) {
+		case float64:
+			result[key] = int(v)
+		case int:
+			result[key] = v
+		case int64:
+			result[key] = int(v)
+		}
+	}
+	return result
+}
+
 // progressLabel returns the configured provider model name for progress messages.
 func progressLabel(modelName string) string {
 	return modelName
@@ -136,6 +169,10 @@ func convertResponseToMCPResult(resp *GenerationResponse, logger Logger) *mcp.Ca
 	if !finishReasonNormal(resp.FinishReason) {
 		text = fmt.Sprintf("[WARN finish_reason=%s]\n", resp.FinishReason) + text
 	}
+	truncated := finishReasonTruncated(resp.FinishReason)
+	if truncated {
+		text += "\n\n" + truncationNote
+	}
 	if logger != nil {
 		u := resp.Usage
 		logger.Info(
@@ -145,11 +182,187 @@ func convertResponseToMCPResult(resp *GenerationResponse, logger Logger) *mcp.Ca
 			u.CachedTokens, u.ReasoningTokens, u.TotalTokens,
 		)
 	}
-	return &mcp.CallToolResult{
+	result := &mcp.CallToolResult{
 		Content: []mcp.Content{
 			mcp.NewTextContent(text),
 		},
 	}
+	// model_used is the model ID the provider reports having served, which
+	// can be a dated snapshot of the configured PROVIDER_MODEL alias.
+	if resp.Model != "" {
+		setResultMeta(result, "model_used", resp.Model)
+	}
+	if truncated {
+		setResultMeta(result, "truncated", true)
+	}
+	return result
+}
+
+// truncationNote is appended to answers cut off at the output token budget.
+// The budget is server configuration, so the advice is to split the task or
+// ask the operator, not to pass a per-call argument.
+const truncationNote = "[NOTE] This answer was truncated at the output token limit. " +
+	"Split the task into smaller questions, or ask the server operator to raise PROVIDER_MAX_TOKENS."
+
+// responseTemplateData is the value GEMINI_RESPONSE_TEMPLATE is executed
+// against.
+type responseTemplateData struct {
+	Answer       string
+	Model        string
+	FinishReason string
+	Usage        UsageInfo
+}
+
+// responseEnvelope is the JSON answer shape returned when
+// GEMINI_RESPONSE_ENVELOPE is enabled. Answer is the raw model text; the
+// finish-reason warning and truncation note shown in plain-text mode are
+// carried by FinishReason and Truncated instead. Thinking and Sources are part
+// of the shared shape but stay empty: neither provider returns reasoning text
+// or grounding sources.
+type responseEnvelope struct {
+	Answer       string       `json:"answer"`
+	Thinking     string       `json:"thinking,omitempty"`
+	Sources      []string     `json:"sources,omitempty"`
+	Usage        *usageReport `json:"usage,omitempty"`
+	ModelUsed    string       `json:"model_used"`
+	FinishReason string       `json:"finish_reason,omitempty"`
+	Truncated    bool         `json:"truncated,omitempty"`
+}
+
+// usageReport is UsageInfo with stable snake_case JSON names for clients.
+type usageReport struct {
+	PromptTokens    int32 `json:"prompt_tokens"`
+	OutputTokens    int32 `json:"output_tokens"`
+	ReasoningTokens int32 `json:"reasoning_tokens"`
+	CachedTokens    int32 `json:"cached_tokens"`
+	TotalTokens     int32 `json:"total_tokens"`
+}
+
+func newUsageReport(u UsageInfo) *usageReport {
+	return &usageReport{
+		PromptTokens:    u.PromptTokens,
+		OutputTokens:    u.OutputTokens,
+		ReasoningTokens: u.ReasoningTokens,
+		CachedTokens:    u.CachedTokens,
+		TotalTokens:     u.TotalTokens,
+	}
+}
+
+// appendUsageContent adds a second text content item {"usage": {...}} with
+// the call's token counts, for clients tracking cost (include_usage). It is
+// skipped for error results and in GEMINI_RESPONSE_ENVELOPE mode, where the
+// envelope already carries usage.
+func (s *GeminiServer) appendUsageContent(result *mcp.CallToolResult, resp *GenerationResponse) {
+	if result == nil || result.IsError || resp == nil || s.config.ResponseEnvelope {
+		return
+	}
+	data, err := json.Marshal(map[string]*usageReport{"usage": newUsageReport(resp.Usage)})
+	if err != nil {
+		return
+	}
+	result.Content = append(result.Content, mcp.NewTextContent(string(data)))
+}
+
+// buildToolResult converts a provider response into the gemini_ask result and
+// applies the server's response shaping: GEMINI_RESPONSE_TEMPLATE, then the
+// GEMINI_APPEND_METADATA trailer for stdio clients. With
+// GEMINI_RESPONSE_ENVELOPE both are skipped and the answer is returned as a
+// responseEnvelope JSON document instead. served is the provider that
+// answered; elapsed is the provider call duration including retries.
+func (s *GeminiServer) buildToolResult(
+	ctx context.Context, genReq GenerationRequest, served ProviderConfig, resp *GenerationResponse, elapsed time.Duration, logger Logger,
+) *mcp.CallToolResult {
+	result := convertResponseToMCPResult(resp, logger)
+	if result.IsError {
+		return result
+	}
+	if fp := requestFingerprint(served, genReq); fp != "" {
+		setResultMeta(result, "request_fingerprint", fp)
+	}
+	text, ok := mcp.AsTextContent(result.Content[0])
+	if !ok {
+		return result
+	}
+	answer := text.Text
+	// Some provider responses omit the model; report the one we asked for.
+	model := resp.Model
+	if model == "" {
+		model = served.Model
+	}
+	if s.config.ResponseEnvelope {
+		env, err := json.Marshal(responseEnvelope{
+			Answer:       resp.Text,
+			Usage:        newUsageReport(resp.Usage),
+			ModelUsed:    model,
+			FinishReason: resp.FinishReason,
+			Truncated:    finishReasonTruncated(resp.FinishReason),
+		})
+		if err != nil {
+			logger.Warn("GEMINI_RESPONSE_ENVELOPE: failed to encode answer, returning it unchanged: %v", err)
+			return result
+		}
+		result.Content[0] = mcp.NewTextContent(string(env))
+		return result
+	}
+	if s.config.ResponseTemplate != nil {
+		var b strings.Builder
+		data := responseTemplateData{Answer: answer, Model: model, FinishReason: resp.FinishReason, Usage: resp.Usage}
+		if err := s.config.ResponseTemplate.Execute(&b, data); err != nil {
+			// A template that fails at runtime must not cost the client its answer.
+			logger.Warn("GEMINI_RESPONSE_TEMPLATE failed, returning answer unchanged: %v", err)
+		} else {
+			answer = b.String()
+		}
+	}
+	if s.config.AppendMetadata && isStdioRequest(ctx) {
+		answer += "\n\n" + formatMetadataLine(model, resp, elapsed)
+	}
+	result.Content[0] = mcp.NewTextContent(answer)
+	return result
+}
+
+// requestFingerprint hashes exactly what was sent to the provider — vendor,
+// model, system prompt, envelope parts and generation settings — so clients
+// can correlate or cache identical requests. encoding/json emits struct
+// fields in declaration order, which makes the serialization canonical. It
+// returns "" if the request cannot be serialized (e.g. a NaN temperature).
+func requestFingerprint(provider ProviderConfig, genReq GenerationRequest) string {
+	payload, err := json.Marshal(struct {
+		Vendor  string
+		Model   string
+		Request GenerationRequest
+	}{provider.Vendor, provider.Model, genReq})
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(payload)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// isStdioRequest reports whether ctx belongs to a stdio tool call. The HTTP
+// transport stamps every request context with httpMethodKey; stdio never does.
+func isStdioRequest(ctx context.Context) bool {
+	method, ok := ctx.Value(httpMethodKey).(string)
+	return !ok || method == ""
+}
+
+// formatMetadataLine renders the compact GEMINI_APPEND_METADATA trailer,
+// e.g. "[model=deepseek-v4-pro tokens=1234 elapsed=3.2s]". model is the
+// served model, already resolved by the caller.
+func formatMetadataLine(model string, resp *GenerationResponse, elapsed time.Duration) string {
+	return fmt.Sprintf("[model=%s tokens=%d elapsed=%s]", model, resp.Usage.TotalTokens, elapsed.Round(100*time.Millisecond))
+}
+
+// setResultMeta records a server-provided field in the tool result's _meta
+// object, leaving the answer text untouched for clients that ignore it.
+func setResultMeta(result *mcp.CallToolResult, key string, value any) {
+	if result.Meta == nil {
+		result.Meta = mcp.NewMetaFromMap(map[string]any{})
+	}
+	if result.Meta.AdditionalFields == nil {
+		result.Meta.AdditionalFields = map[string]any{}
+	}
+	result.Meta.AdditionalFields[key] = value
 }
 
 // SafeWriter provides error-safe writing to strings.Builder for handlers
@@ -204,9 +417,38 @@ func validateRequiredString(req mcp.CallToolRequest, paramName string) (string,
 // validateFilePathArray validates an array of GitHub file paths.
 func validateFilePathArray(filePaths []string) error {
 	for _, filePath := range filePaths {
-		if strings.Contains(filePath, "..") || strings.HasPrefix(filePath, "/") {
+		// Check the normalized form so surrounding whitespace cannot hide a
+		// leading "/"; ".." is rejected anywhere, even where Clean would fold it.
+		normalized := normalizeGitHubFilePath(filePath)
+		if strings.Contains(filePath, "..") || strings.HasPrefix(normalized, "/") {
 			return fmt.Errorf("invalid file path: %s. Path must be relative and within the repository", filePath)
 		}
+		if normalized == "" {
+			return fmt.Errorf("invalid file path: %q. Path must name a file in the repository", filePath)
+		}
 	}
 	return nil
 }
+
+// normalizeGitHubFilePaths returns the cleaned form of each path so that
+// "./src//main.go" and "src/main.go" address the same file. Callers must run
+// validateFilePathArray first; URL escaping happens later, per segment, in
+// buildContentsAPIURL.
+func normalizeGitHubFilePaths(filePaths []string) []string {
+	out := make([]string, len(filePaths))
+	for i, filePath := range filePaths {
+		out[i] = normalizeGitHubFilePath(filePath)
+	}
+	return out
+}
+
+// normalizeGitHubFilePath trims surrounding whitespace and collapses "." and
+// duplicate-slash segments. It returns "" for paths that clean to the
+// repository root.
+func normalizeGitHubFilePath(filePath string) string {
+	cleaned := path.Clean(strings.TrimSpace(filePath))
+	if cleaned == "." {
+		return ""
+	}
+	return cleaned
+}
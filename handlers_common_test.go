@@ -31,7 +31,23 @@ func TestExtractArgumentStringArray(t *testing.T) {
 func TestRetainedHelpers(t *testing.T) {
 	assert.NoError(t, validateFilePathArray([]string{"a.go"}))
 	assert.Error(t, validateFilePathArray([]string{"../a.go"}))
+	assert.Error(t, validateFilePathArray([]string{" /etc/passwd"}))
+	assert.Error(t, validateFilePathArray([]string{"\t/etc/passwd"}))
 	writer := NewSafeWriter(NewLogger(LevelError))
 	writer.Write("%s", "ok")
 	assert.Equal(t, "ok", writer.String())
 }
+
+func TestExtractArgumentIntMap(t *testing.T) {
+	for _, tt := range []struct {
+		value any
+		want  map[string]int
+	}{
+		{map[string]any{"a.go": float64(2), "b.go": "x"}, map[string]int{"a.go": 2}},
+		{`{"a.go": 3}`, map[string]int{"a.go": 3}},
+		{"a.go", nil},
+	} {
+		req := mcp.CallToolRequest{Params: mcp.CallToolParams{Arguments: map[string]any{"p": tt.value}}}
+		assert.Equal(t, tt.want, extractArgumentIntMap(req, "p"))
+	}
+}
@@ -122,7 +122,11 @@ func createHTTPMiddleware(config *Config, logger Logger) server.HTTPContextFunc
 	// Create authentication middleware
 	var authMiddleware *AuthMiddleware
 	if config.AuthEnabled {
-		authMiddleware = NewAuthMiddleware(config.AuthSecretKey, config.AuthEnabled, logger)
+		authMiddleware = NewAuthMiddleware(config.AuthSecretKey, config.AuthEnabled, logger,
+			WithAuthIssuers(config.AuthIssuers...),
+			WithAuthAudiences(config.AuthAudiences...),
+			WithAuthJWKS(config.AuthJWKSURL, nil),
+		)
 		logger.Info("HTTP authentication enabled")
 	}
 
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	jwksFetchTimeout = 10 * time.Second
+	// jwksMinRefresh bounds how often an unknown kid can trigger a refetch,
+	// so a client spraying random kids cannot hammer the IdP.
+	jwksMinRefresh = 30 * time.Second
+	// jwksMaxBody caps the JWKS document; real key sets are a few KB.
+	jwksMaxBody = 1 << 20
+)
+
+// jwksCache holds the RSA signing keys published at GEMINI_AUTH_JWKS_URL,
+// indexed by kid. Keys are fetched lazily and refetched when a token names
+// a kid the cache does not know (key rotation).
+type jwksCache struct {
+	url        string
+	client     *http.Client
+	minRefresh time.Duration
+
+	mu          sync.Mutex
+	keys        map[string]*rsa.PublicKey
+	lastRefresh time.Time
+	inflight    chan struct{} // closed when the running fetch finishes
+}
+
+func newJWKSCache(url string, client *http.Client) *jwksCache {
+	if client == nil {
+		client = &http.Client{Timeout: jwksFetchTimeout}
+	}
+	return &jwksCache{url: url, client: client, minRefresh: jwksMinRefresh}
+}
+
+// key returns the public key for kid, refreshing the set once on a miss.
+// The fetch runs outside mu so cached kids keep validating while the IdP is
+// slow; concurrent misses wait for the running fetch instead of starting
+// their own. Refreshes are throttled by minRefresh whether or not the last
+// one succeeded.
+func (c *jwksCache) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	c.mu.Lock()
+	for {
+		if k, ok := c.keys[kid]; ok {
+			c.mu.Unlock()
+			return k, nil
+		}
+		wait := c.inflight
+		if wait == nil {
+			break
+		}
+		c.mu.Unlock()
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		c.mu.Lock()
+	}
+	if !c.lastRefresh.IsZero() && time.Since(c.lastRefresh) < c.minRefresh {
+		c.mu.Unlock()
+		return nil, fmt.Errorf("unknown JWKS key id %q", kid)
+	}
+	done := make(chan struct{})
+	previous := c.lastRefresh
+	c.inflight, c.lastRefresh = done, time.Now()
+	c.mu.Unlock()
+
+	keys, err := c.fetch(ctx)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.inflight = nil
+	close(done)
+	switch {
+	case err != nil && ctx.Err() != nil:
+		// The caller gave up; that says nothing about the IdP, so do not
+		// let it hold off the next refresh.
+		c.lastRefresh = previous
+		return nil, ctx.Err()
+	case err != nil:
+		return nil, fmt.Errorf("fetching JWKS: %w", err)
+	}
+	c.keys = keys
+	if k, ok := c.keys[kid]; ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("unknown JWKS key id %q", kid)
+}
+
+// jwk is the subset of RFC 7517 fields needed for RSA signature keys.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+func (c *jwksCache) fetch(ctx context.Context) (map[string]*rsa.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(nil, resp.Body, jwksMaxBody)).Decode(&set); err != nil {
+		return nil, fmt.Errorf("decoding key set: %w", err)
+	}
+	// Keys that are not RSA signing keys or fail to parse are skipped, so
+	// one bad entry does not lock out tokens signed with the others.
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		pub, err := k.rsaPublicKey()
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = pub
+	}
+	return keys, nil
+}
+
+func (k jwk) rsaPublicKey() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("invalid modulus: %w", err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exponent: %w", err)
+	}
+	exp := new(big.Int).SetBytes(e)
+	if len(n) == 0 || !exp.IsInt64() || exp.Int64() < 3 || exp.Int64() > 1<<31-1 {
+		return nil, fmt.Errorf("invalid RSA parameters")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exp.Int64())}, nil
+}
@@ -43,7 +43,7 @@ func buildMCPServerOptions(config *Config, logger Logger) []server.ServerOption
 		server.WithDescription("Gemini LLM for analysis, reasoning and research"),
 		server.WithWebsiteURL(serverWebsiteURL),
 		server.WithInstructions(`gemini_ask: send a prompt to the configured provider, optionally with GitHub repository context.
-github_repo is required when using any github_* parameter. github_files requires github_ref.`),
+github_* parameters need github_repo unless the server has a default repository; github_ref defaults to the server's default ref for that repository, else the repository's default branch.`),
 		server.WithToolCapabilities(true),
 		server.WithRecovery(),
 		server.WithInputSchemaValidation(),
@@ -90,8 +90,8 @@ type cliFlags struct {
 // recoverable startup failure (the caller should enter degraded mode).
 func applyCLIOverrides(flags *cliFlags, config *Config, logger Logger) error {
 	if flags.geminiTemperature >= 0 {
-		if flags.geminiTemperature > 1.0 {
-			logger.Error("Invalid temperature value: %v. Must be between 0.0 and 1.0", flags.geminiTemperature)
+		if flags.geminiTemperature > maxGeminiTemperature {
+			logger.Error("Invalid temperature value: %v. Must be between 0.0 and %.1f", flags.geminiTemperature, maxGeminiTemperature)
 			return fmt.Errorf("invalid temperature: %v", flags.geminiTemperature)
 		}
 		logger.Info("Overriding Gemini temperature with flag value: %v", flags.geminiTemperature)
@@ -111,8 +111,8 @@ func applyCLIOverrides(flags *cliFlags, config *Config, logger Logger) error {
 // internal callers) plus the --auth-enabled flag flipping AuthEnabled after
 // the loader ran.
 func validateAuthPostOverride(config *Config, logger Logger) bool {
-	if config.AuthEnabled && config.AuthSecretKey == "" {
-		logger.Error("CRITICAL: Authentication is enabled, but GEMINI_AUTH_SECRET_KEY is not set. Server is shutting down.")
+	if config.AuthEnabled && config.AuthSecretKey == "" && config.AuthJWKSURL == "" {
+		logger.Error("CRITICAL: Authentication is enabled, but neither GEMINI_AUTH_SECRET_KEY nor GEMINI_AUTH_JWKS_URL is set. Server is shutting down.")
 		return false
 	}
 	if config.AuthEnabled && config.HTTPPublicURL == "" {
@@ -155,7 +155,7 @@ func runMain(args []string) int {
 	flagSet.SetOutput(io.Discard)
 
 	flags := &cliFlags{}
-	flagSet.Float64Var(&flags.geminiTemperature, "gemini-temperature", -1, "Temperature setting (0.0-1.0, overrides env var)")
+	flagSet.Float64Var(&flags.geminiTemperature, "gemini-temperature", -1, "Temperature setting (0.0-2.0, overrides env var)")
 	flagSet.StringVar(&flags.transport, "transport", "stdio", "Transport mode: 'stdio' (default) or 'http'")
 	flagSet.BoolVar(&flags.authEnabled, "auth-enabled", false, "Enable JWT authentication for HTTP transport (overrides env var)")
 	flagSet.BoolVar(&flags.generateToken, "generate-token", false, "Generate a JWT token and exit")
@@ -178,7 +178,7 @@ func runMain(args []string) int {
 	config, err := newConfigFn(logger)
 	if err != nil {
 		ctx := context.WithValue(context.Background(), loggerKey, logger)
-		handleStartupErrorFn(ctx, err)
+		handleStartupErrorFn(ctx, err, reinitialize(flags, logger))
 		return 0
 	}
 
@@ -186,11 +186,11 @@ func runMain(args []string) int {
 	ctx = context.WithValue(ctx, configKey, config)
 
 	if err := applyCLIOverrides(flags, config, logger); err != nil {
-		handleStartupErrorFn(ctx, err)
+		handleStartupErrorFn(ctx, err, reinitialize(flags, logger))
 		return 0
 	}
 
-	// Fatal post-override checks: authentication demands a secret key and a
+	// Fatal post-override checks: authentication demands a key source and a
 	// stable public URL; we must never enter degraded mode while advertising
 	// auth.
 	if !validateAuthPostOverride(config, logger) {
@@ -201,7 +201,7 @@ func runMain(args []string) int {
 	logServerCapabilities(logger, config)
 
 	if err := setupGeminiServerFn(ctx, mcpServer, config); err != nil {
-		handleStartupErrorFn(ctx, err)
+		handleStartupErrorFn(ctx, err, reinitialize(flags, logger))
 		return 0
 	}
 
@@ -11,3 +11,40 @@ func TestApplyCLIOverrides(t *testing.T) {
 	assert.NoError(t, require)
 	assert.Equal(t, 0.4, cfg.GeminiTemperature)
 }
+
+func TestApplyCLIOverridesTemperatureRange(t *testing.T) {
+	for _, tt := range []struct {
+		temp    float64
+		wantErr bool
+	}{{1.8, false}, {2.0, false}, {2.1, true}} {
+		cfg := &Config{GeminiTemperature: 1}
+		err := applyCLIOverrides(&cliFlags{geminiTemperature: tt.temp}, cfg, NewLogger(LevelError))
+		if tt.wantErr {
+			assert.Error(t, err, tt.temp)
+			assert.Equal(t, 1.0, cfg.GeminiTemperature)
+			continue
+		}
+		assert.NoError(t, err, tt.temp)
+		assert.Equal(t, tt.temp, cfg.GeminiTemperature)
+	}
+}
+
+func TestValidateAuthPostOverride(t *testing.T) {
+	const publicURL = "https://mcp.example.com/mcp"
+	tests := []struct {
+		name string
+		cfg  Config
+		want bool
+	}{
+		{"auth disabled", Config{}, true},
+		{"shared secret", Config{AuthEnabled: true, AuthSecretKey: "s", HTTPPublicURL: publicURL}, true},
+		{"JWKS only", Config{AuthEnabled: true, AuthJWKSURL: "https://idp.example.com/jwks", HTTPPublicURL: publicURL}, true},
+		{"no key source", Config{AuthEnabled: true, HTTPPublicURL: publicURL}, false},
+		{"no public URL", Config{AuthEnabled: true, AuthJWKSURL: "https://idp.example.com/jwks"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, validateAuthPostOverride(&tt.cfg, NewLogger(LevelError)))
+		})
+	}
+}
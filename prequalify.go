@@ -168,7 +168,7 @@ func (s *GeminiServer) resolveSystemPromptAsync(ctx context.Context, req mcp.Cal
 		return ch
 	}
 	go func() {
-		summary := buildContextSummary(req)
+		summary := s.buildContextSummary(req)
 		cat, err := s.prequalifyQuery(ctx, query, summary)
 		fallback := err != nil
 		if err != nil {
@@ -190,11 +190,16 @@ func (s *GeminiServer) resolveSystemPromptAsync(ctx context.Context, req mcp.Cal
 
 // buildContextSummary produces a short one-line description of the GitHub
 // context attached to a request, suitable for the pre-qualification classifier.
-// It contains no actual content — just names, numbers, and counts.
-func buildContextSummary(req mcp.CallToolRequest) string {
+// It contains no actual content — just names, numbers, and counts. The repo
+// falls back to GEMINI_DEFAULT_GITHUB_REPO like the fetchers do.
+func (s *GeminiServer) buildContextSummary(req mcp.CallToolRequest) string {
 	var parts []string
 
-	repo := extractArgumentString(req, "github_repo")
+	repo := s.githubRepo(req)
+
+	if req.GetBool("github_tree", false) {
+		parts = append(parts, "directory tree")
+	}
 
 	if prNum, hasPR := extractGitHubPRNumber(req); hasPR {
 		parts = append(parts, fmt.Sprintf("PR #%d", prNum))
@@ -227,11 +232,10 @@ func buildContextSummary(req mcp.CallToolRequest) string {
 	return summary
 }
 
-// hasGitHubContext returns true if the request includes any github_* parameters.
+// hasGitHubContext returns true if the request attaches any GitHub context
+// (files, PR, commits, diff or tree). github_repo alone, or a server default
+// repository, attaches nothing and does not count.
 func hasGitHubContext(req mcp.CallToolRequest) bool {
-	if extractArgumentString(req, "github_repo") != "" {
-		return true
-	}
 	if _, hasPR := extractGitHubPRNumber(req); hasPR {
 		return true
 	}
@@ -244,5 +248,8 @@ func hasGitHubContext(req mcp.CallToolRequest) bool {
 	if extractArgumentString(req, "github_diff_base") != "" {
 		return true
 	}
+	if req.GetBool("github_tree", false) {
+		return true
+	}
 	return false
 }
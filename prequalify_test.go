@@ -79,3 +79,17 @@ func TestResolveSystemPromptAsyncFallback(t *testing.T) {
 		assert.Equal(t, categoryAnalyze, got.Category)
 	})
 }
+
+func TestPrequalifyContextUsesDefaultRepo(t *testing.T) {
+	s := &GeminiServer{config: &Config{DefaultGitHubRepo: "o/default"}}
+	treeOnly := mcp.CallToolRequest{Params: mcp.CallToolParams{Arguments: map[string]any{"github_tree": true}}}
+	assert.Equal(t, "Context: directory tree in o/default", s.buildContextSummary(treeOnly))
+	assert.True(t, hasGitHubContext(treeOnly))
+	assert.False(t, hasGitHubContext(mcp.CallToolRequest{}), "a default repo alone attaches no context")
+
+	explicit := mcp.CallToolRequest{Params: mcp.CallToolParams{Arguments: map[string]any{"github_repo": "o/r", "github_tree": true}}}
+	assert.Equal(t, "Context: directory tree in o/r", s.buildContextSummary(explicit))
+
+	none := &GeminiServer{config: &Config{}}
+	assert.Equal(t, "Context: directory tree", none.buildContextSummary(treeOnly))
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"html"
+	"path"
 	"strings"
 
 	"github.com/mark3labs/mcp-go/mcp"
@@ -18,19 +19,97 @@ const (
 
 // createTaskInstructions generates the instructional text for the MCP client.
 // The server picks the system prompt server-side via pre-qualification — the
-// client cannot inject one.
-func createTaskInstructions(problemStatement string) string {
+// client cannot inject one. extraSteps are appended to the numbered list after
+// the two standard steps; callers must escape them.
+func createTaskInstructions(problemStatement string, extraSteps ...string) string {
 	// Basic sanitization to prevent any HTML/XML tags from being interpreted.
 	sanitizedProblemStatement := html.EscapeString(problemStatement)
 
+	var steps strings.Builder
+	for i, step := range extraSteps {
+		fmt.Fprintf(&steps, "%d. %s\n", i+3, step)
+	}
+
 	return fmt.Sprintf("You MUST NOW use the `gemini_ask` tool to solve this problem.\n\n"+
 		"Follow these instructions carefully:\n"+
 		"1. Set the `query` argument to a clear and concise request based on the user's problem statement.\n"+
 		"2. Provide the code to be analyzed using ONE of the following methods (in order of preference):\n"+
 		"   a) PREFERRED: Use `github_files` array with `github_repo` (owner/repo) and `github_ref` (branch/tag/commit)\n"+
 		"   b) For small code snippets only: Embed code directly into the `query` argument\n"+
+		"%s"+
 		userInstructionTemplate+
-		"<problem_statement>\n```\n%s\n```\n</problem_statement>", sanitizedProblemStatement)
+		"<problem_statement>\n```\n%s\n```\n</problem_statement>", steps.String(), sanitizedProblemStatement)
+}
+
+// testFrameworkForLanguage maps a project language (lowercase) to the test
+// framework test_generate asks for when the client names no framework.
+var testFrameworkForLanguage = map[string]string{
+	"go":         "the standard testing package (go test)",
+	"python":     "pytest",
+	"javascript": "Jest",
+	"typescript": "Jest",
+	"rust":       "the built-in test harness (cargo test)",
+	"java":       "JUnit 5",
+}
+
+// testFrameworkForExtension maps file extensions named in the problem
+// statement to a language key of testFrameworkForLanguage.
+var testFrameworkForExtension = map[string]string{
+	".go":   "go",
+	".py":   "python",
+	".js":   "javascript",
+	".jsx":  "javascript",
+	".ts":   "typescript",
+	".tsx":  "typescript",
+	".rs":   "rust",
+	".java": "java",
+}
+
+// resolveTestFramework picks the test framework for test_generate: an
+// explicit framework wins, then the language argument, then the single
+// language detected from file names in the problem statement. It returns ""
+// when the language is unknown or the statement mixes languages.
+func resolveTestFramework(framework, language, problemStatement string) string {
+	if framework != "" {
+		return framework
+	}
+	if language != "" {
+		return testFrameworkForLanguage[strings.ToLower(language)]
+	}
+	detected := ""
+	for _, word := range strings.Fields(problemStatement) {
+		lang, ok := testFrameworkForExtension[strings.ToLower(path.Ext(strings.Trim(word, "`'\",.;:()[]")))]
+		if !ok {
+			continue
+		}
+		if detected != "" && detected != lang {
+			return ""
+		}
+		detected = lang
+	}
+	return testFrameworkForLanguage[detected]
+}
+
+// buildTestGenerateHandler returns a handler for the test_generate prompt. It
+// behaves like the generic handler and adds a step naming the test framework
+// the generated tests must use.
+func buildTestGenerateHandler(_ *GeminiServer) mcpPromptHandlerFunc {
+	return func(_ context.Context, req mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+		problemStatement, err := requiredPromptArg(req, "problem_statement")
+		if err != nil {
+			return nil, err
+		}
+		framework := resolveTestFramework(
+			strings.TrimSpace(req.Params.Arguments["framework"]),
+			strings.TrimSpace(req.Params.Arguments["language"]),
+			problemStatement,
+		)
+		var steps []string
+		if framework != "" {
+			steps = append(steps, fmt.Sprintf("In the `query`, require the tests to be written with %s.", html.EscapeString(framework)))
+		}
+		return promptMessage(req.Params.Name, createTaskInstructions(problemStatement, steps...)), nil
+	}
 }
 
 // --- GitHub workflow prompt handler builders ---
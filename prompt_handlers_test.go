@@ -156,3 +156,38 @@ func TestBuildCompareRefsHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestBuildTestGenerateHandler(t *testing.T) {
+	h := buildTestGenerateHandler(nil)
+	for _, tt := range []struct {
+		name string
+		args map[string]string
+		want string // "" = no framework step
+	}{
+		{"go language", map[string]string{"language": "Go"}, "3. In the `query`, require the tests to be written with the standard testing package (go test)."},
+		{"python language", map[string]string{"language": "python"}, "written with pytest."},
+		{"framework overrides language", map[string]string{"language": "python", "framework": "unittest"}, "written with unittest."},
+		{"detected from go files", map[string]string{"problem_statement": "Test `handler.go` and server.go"}, "go test"},
+		{"detected from python files", map[string]string{"problem_statement": "Cover utils.py, please."}, "pytest"},
+		{"mixed languages", map[string]string{"problem_statement": "Test main.go and app.py"}, ""},
+		{"unknown language", map[string]string{"language": "cobol"}, ""},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			args := map[string]string{"problem_statement": "Write tests."}
+			for k, v := range tt.args {
+				args[k] = v
+			}
+			out := promptText(t, h, "test_generate", args)
+			assert.Contains(t, out, "gemini_ask")
+			if tt.want == "" {
+				assert.NotContains(t, out, "3. ")
+				return
+			}
+			assert.Contains(t, out, tt.want)
+		})
+	}
+
+	_, err := h(context.Background(), mcp.GetPromptRequest{Params: mcp.GetPromptParams{Name: "test_generate"}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "missing required argument: problem_statement")
+}
@@ -29,10 +29,7 @@ var Prompts = []*PromptDefinition{
 		"architecture_analysis",
 		"Analyze system architecture, design patterns, and structural decisions",
 	),
-	NewPromptDefinition(
-		"test_generate",
-		"Generate unit tests, integration tests, or test cases for code",
-	),
+	newTestGeneratePromptDefinition(),
 	NewPromptDefinition(
 		"security_analysis",
 		"Analyze code for security vulnerabilities and best practices",
@@ -96,3 +93,19 @@ func newGitHubPromptDefinition(
 		HandlerFactory: factory,
 	}
 }
+
+// newTestGeneratePromptDefinition extends the generic test_generate prompt
+// with optional language and framework arguments so the generated tests use
+// the project's test framework (see resolveTestFramework).
+func newTestGeneratePromptDefinition() *PromptDefinition {
+	p := NewPromptDefinition(
+		"test_generate",
+		"Generate unit tests, integration tests, or test cases for code",
+	)
+	p.Arguments = append(p.Arguments,
+		mcp.PromptArgument{Name: "language", Description: "Optional: project language (go, python, javascript, typescript, rust, java); selects its usual test framework."},
+		mcp.PromptArgument{Name: "framework", Description: "Optional: test framework to use (e.g. pytest, Jest); overrides language."},
+	)
+	p.HandlerFactory = buildTestGenerateHandler
+	return p
+}
@@ -74,6 +74,45 @@ func NewPrequalifyProvider(cfg *Config, logger Logger) (Provider, error) {
 	}
 }
 
+// defaultEscalationMap maps a model to the more capable model of the same
+// vendor that GEMINI_ESCALATE_ON_EMPTY retries with when the first answer
+// comes back empty. GEMINI_ESCALATION_MAP replaces it; models without an
+// entry are not escalated.
+var defaultEscalationMap = map[string]string{
+	"deepseek-v4-flash": "deepseek-v4-pro",
+	"qwen3.7-plus":      "qwen3.7-max",
+}
+
+// NewEscalationProvider creates the provider used to retry empty answers on a
+// larger model. It returns (nil, nil) when escalation is disabled or the
+// configured model has no escalation target.
+func NewEscalationProvider(cfg *Config, logger Logger) (Provider, error) {
+	if cfg == nil {
+		return nil, errors.New("config cannot be nil")
+	}
+	model, ok := cfg.escalationTarget(cfg.Provider.Model)
+	if !cfg.EscalateOnEmpty || !ok {
+		return nil, nil
+	}
+	ecfg := *cfg
+	ecfg.Provider.Model = model
+	return NewProvider(&ecfg, logger)
+}
+
+// NewFailoverProvider creates the secondary provider from
+// cfg.FailoverProvider. It returns (nil, nil) when no failover is configured.
+func NewFailoverProvider(cfg *Config, logger Logger) (Provider, error) {
+	if cfg == nil {
+		return nil, errors.New("config cannot be nil")
+	}
+	if cfg.FailoverProvider == nil {
+		return nil, nil
+	}
+	fcfg := *cfg
+	fcfg.Provider = *cfg.FailoverProvider
+	return NewProvider(&fcfg, logger)
+}
+
 // NewProvider creates the configured model provider.
 func NewProvider(cfg *Config, logger Logger) (Provider, error) {
 	if cfg == nil {
@@ -158,3 +197,25 @@ func finishReasonNormal(reason string) bool {
 	}
 	return false
 }
+
+// finishReasonTruncated reports whether a finish reason means generation
+// stopped at the output token budget: "length" (Chat Completions),
+// "max_output_tokens" (Responses API incomplete_details) or "MAX_TOKENS".
+func finishReasonTruncated(reason string) bool {
+	switch reason {
+	case "length", "max_output_tokens", "MAX_TOKENS":
+		return true
+	}
+	return false
+}
+
+// finishReasonSafety reports whether a finish reason means the vendor's
+// content filter withheld the answer. Retrying such a response on another
+// model of the same vendor would be filtered again.
+func finishReasonSafety(reason string) bool {
+	switch reason {
+	case "content_filter", "SAFETY":
+		return true
+	}
+	return false
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"slices"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -81,6 +82,66 @@ func TestNewPrequalifyProvider(t *testing.T) {
 	})
 }
 
+// TestNewEscalationProvider verifies escalation targets the larger model of
+// the same vendor and stays off when disabled or already top tier.
+func TestNewEscalationProvider(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		vendor  string
+		model   string
+		enabled bool
+		want    string // "" = no escalator
+	}{
+		{"deepseek flash escalates to pro", "deepseek", "deepseek-v4-flash", true, "deepseek-v4-pro"},
+		{"qwen plus escalates to max", "qwen", "qwen3.7-plus", true, "qwen3.7-max"},
+		{"top tier has no target", "deepseek", "deepseek-v4-pro", true, ""},
+		{"disabled", "deepseek", "deepseek-v4-flash", false, ""},
+		{"custom map", "qwen", "qwen3.7-max", true, "qwen3.8-max-preview"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				Provider:        ProviderConfig{Vendor: tt.vendor, APIKey: "key", BaseURL: "https://api.example", Model: tt.model},
+				EscalateOnEmpty: tt.enabled,
+			}
+			if tt.name == "custom map" {
+				cfg.EscalationMap = map[string]string{"qwen3.7-max": "qwen3.8-max-preview"}
+			}
+			p, err := NewEscalationProvider(cfg, NewLogger(LevelError))
+			require.NoError(t, err)
+			switch p := p.(type) {
+			case nil:
+				assert.Empty(t, tt.want)
+			case *openaiProvider:
+				assert.Equal(t, tt.want, p.model)
+			case *responsesProvider:
+				assert.Equal(t, tt.want, p.model)
+			default:
+				t.Fatalf("unexpected provider type %T", p)
+			}
+		})
+	}
+	for from, to := range defaultEscalationMap {
+		assert.Contains(t, slices.Concat(deepseekModels, qwenModels), from)
+		assert.Contains(t, slices.Concat(deepseekModels, qwenModels), to)
+	}
+}
+
+func TestNewFailoverProvider(t *testing.T) {
+	p, err := NewFailoverProvider(&Config{Provider: ProviderConfig{Vendor: "deepseek", Model: "deepseek-v4-pro"}}, NewLogger(LevelError))
+	require.NoError(t, err)
+	assert.Nil(t, p)
+
+	cfg := &Config{
+		Provider:         ProviderConfig{Vendor: "deepseek", APIKey: "key", BaseURL: "https://ds.example", Model: "deepseek-v4-pro"},
+		FailoverProvider: &ProviderConfig{Vendor: "qwen", APIKey: "key2", BaseURL: "https://qwen.example", Model: "qwen3.7-max"},
+	}
+	p, err = NewFailoverProvider(cfg, NewLogger(LevelError))
+	require.NoError(t, err)
+	rp, ok := p.(*responsesProvider)
+	require.True(t, ok, "qwen failover must produce a responsesProvider")
+	assert.Equal(t, "qwen3.7-max", rp.model)
+}
+
 // TestNewProviderThinkingForcedWiring guards the slices.Contains wiring that
 // sets the dialect's thinkingForced flag: thinking-only models must get it,
 // and stable models must not (a silent miss means effort=none and a 400).
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"fmt"
+	"slices"
 	"time"
 
 	"github.com/mark3labs/mcp-go/mcp"
@@ -25,8 +26,19 @@ func setupGeminiServer(ctx context.Context, mcpServer *server.MCPServer, config
 
 	// Create handler for gemini_ask using direct handler
 	// Register gemini_ask with logger wrapper using shared tool definition
-	mcpServer.AddTool(GeminiAskTool, wrapHandlerWithLogger(geminiSvc.GeminiAskHandler, "gemini_ask", logger))
-	logger.Info("Registered tool: gemini_ask")
+	warnUnknownNames(logger, "GEMINI_ENABLED_TOOLS", config.EnabledTools, []string{GeminiAskTool.Name, GeminiStatusTool.Name})
+	if isNameEnabled(config.EnabledTools, GeminiAskTool.Name) {
+		mcpServer.AddTool(GeminiAskTool, wrapHandlerWithLogger(geminiSvc.GeminiAskHandler, "gemini_ask", logger))
+		logger.Info("Registered tool: gemini_ask")
+	} else {
+		logger.Info("Skipped tool: gemini_ask (not in GEMINI_ENABLED_TOOLS)")
+	}
+	if isNameEnabled(config.EnabledTools, GeminiStatusTool.Name) {
+		mcpServer.AddTool(GeminiStatusTool, wrapHandlerWithLogger(geminiSvc.GeminiStatusHandler, "gemini_status", logger))
+		logger.Info("Registered tool: gemini_status")
+	} else {
+		logger.Info("Skipped tool: gemini_status (not in GEMINI_ENABLED_TOOLS)")
+	}
 
 	registerPrompts(mcpServer, geminiSvc, logger)
 
@@ -39,8 +51,14 @@ func setupGeminiServer(ctx context.Context, mcpServer *server.MCPServer, config
 	return nil
 }
 
-// handleStartupError handles initialization errors by setting up an error server
-func handleStartupError(ctx context.Context, err error) {
+// startupRetryFunc re-attempts initialisation against the degraded server,
+// registering the real handlers on success.
+type startupRetryFunc func(ctx context.Context, mcpServer *server.MCPServer) error
+
+// handleStartupError handles initialization errors by setting up an error server.
+// When retry is non-nil and GEMINI_STARTUP_RETRY_INTERVAL is positive, retry
+// runs in the background until it succeeds and the server leaves degraded mode.
+func handleStartupError(ctx context.Context, err error, retry startupRetryFunc) {
 	// Safely extract logger from context
 	loggerValue := ctx.Value(loggerKey)
 	logger, ok := loggerValue.(Logger)
@@ -69,22 +87,104 @@ func handleStartupError(ctx context.Context, err error) {
 	// Register error handling for tools
 	registerErrorTools(mcpServer, errorServer, logger)
 
+	// Read straight from the environment: the config may be what failed.
+	if interval := parseEnvVarDuration("GEMINI_STARTUP_RETRY_INTERVAL", 0, logger); retry != nil && interval > 0 {
+		logger.Info("Retrying initialization every %s", interval)
+		go retryStartup(ctx, mcpServer, retry, interval, logger)
+	}
+
 	// Start server in degraded mode
 	logger.Info("Starting Gemini MCP server in degraded mode")
-	if err := server.ServeStdio(mcpServer); err != nil {
+	if err := serveStdioFn(mcpServer); err != nil {
 		logger.Error("Server error in degraded mode: %v", err)
 		osExitFn(1)
 	}
 }
 
+// retryStartup calls retry every interval until it succeeds or ctx ends, and
+// reports whether the server recovered. Re-registering a tool under the same
+// name replaces its degraded handler, and mcp-go tells connected clients via
+// notifications/tools/list_changed.
+func retryStartup(ctx context.Context, mcpServer *server.MCPServer, retry startupRetryFunc, interval time.Duration, logger Logger) bool {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+		if err := retry(ctx, mcpServer); err != nil {
+			logger.Warn("Initialization retry %d failed: %v", attempt, err)
+			continue
+		}
+		// The degraded server was built without the tasks capability, so
+		// the recovered tools must not claim task support either.
+		for _, t := range mcpServer.ListTools() {
+			if t.Tool.Execution != nil {
+				mcpServer.AddTool(degradedTool(t.Tool), t.Handler)
+			}
+		}
+		logger.Info("Initialization retry %d succeeded; leaving degraded mode", attempt)
+		return true
+	}
+}
+
+// reinitialize returns the startupRetryFunc used by runMain. It repeats the
+// startup sequence from scratch (config load, CLI overrides, auth checks,
+// tool registration). NewConfig re-reads GEMINI_CONFIG_FILE on every call, so
+// a corrected config file heals the server; the process environment itself
+// cannot change from outside. Degraded tools the new config does not enable
+// are removed.
+func reinitialize(flags *cliFlags, logger Logger) startupRetryFunc {
+	return func(ctx context.Context, mcpServer *server.MCPServer) error {
+		config, err := newConfigFn(logger)
+		if err != nil {
+			return err
+		}
+		if err := applyCLIOverrides(flags, config, logger); err != nil {
+			return err
+		}
+		if !validateAuthPostOverride(config, logger) {
+			return fmt.Errorf("authentication settings are incomplete")
+		}
+		ctx = context.WithValue(ctx, configKey, config)
+		if err := setupGeminiServerFn(ctx, mcpServer, config); err != nil {
+			return err
+		}
+		for _, name := range []string{GeminiAskTool.Name, GeminiStatusTool.Name} {
+			if !isNameEnabled(config.EnabledTools, name) {
+				mcpServer.DeleteTools(name)
+			}
+		}
+		return nil
+	}
+}
+
 // Define the expected handler signature for tools
 type MCPToolHandlerFunc = server.ToolHandlerFunc
 
 // registerPrompts wires every PromptDefinition into the MCP server. Prompts
 // with a HandlerFactory get a custom handler (used by the github-workflow
 // prompts); all others fall back to the generic problem_statement handler.
+//
+// When GEMINI_ENABLED_PROMPTS is set, only the listed prompts are registered.
 func registerPrompts(mcpServer *server.MCPServer, geminiSvc *GeminiServer, logger Logger) {
+	var enabled []string
+	if geminiSvc != nil && geminiSvc.config != nil {
+		enabled = geminiSvc.config.EnabledPrompts
+	}
+	known := make([]string, 0, len(Prompts))
 	for _, p := range Prompts {
+		known = append(known, p.Name)
+	}
+	warnUnknownNames(logger, "GEMINI_ENABLED_PROMPTS", enabled, known)
+
+	for _, p := range Prompts {
+		if !isNameEnabled(enabled, p.Name) {
+			logger.Debug("Skipped prompt: %s (not in GEMINI_ENABLED_PROMPTS)", p.Name)
+			continue
+		}
 		var handler server.PromptHandlerFunc
 		if p.HandlerFactory != nil {
 			handler = server.PromptHandlerFunc(p.HandlerFactory(geminiSvc))
@@ -96,6 +196,23 @@ func registerPrompts(mcpServer *server.MCPServer, geminiSvc *GeminiServer, logge
 	}
 }
 
+// isNameEnabled reports whether name appears in the enabled allowlist. An
+// empty allowlist enables everything.
+func isNameEnabled(enabled []string, name string) bool {
+	return len(enabled) == 0 || slices.Contains(enabled, name)
+}
+
+// warnUnknownNames logs allowlist entries that match nothing, so a typo in
+// GEMINI_ENABLED_TOOLS / GEMINI_ENABLED_PROMPTS does not silently hide a
+// tool or prompt.
+func warnUnknownNames(logger Logger, envVar string, enabled, known []string) {
+	for _, name := range enabled {
+		if !slices.Contains(known, name) {
+			logger.Warn("%s: unknown name %q ignored", envVar, name)
+		}
+	}
+}
+
 // enforceHTTPAuth checks for authentication on HTTP requests. Successful
 // authentication is logged at the tool-entry level by wrapHandlerWithLogger,
 // so this function is silent on the happy path and only warns on failure.
@@ -128,6 +245,8 @@ func wrapHandlerWithLogger(handler server.ToolHandlerFunc, toolName string, logg
 		reqID := newRequestID()
 		ctx, rlog := withRequestLogger(ctx, logger, reqID)
 		start := time.Now()
+		callStats.begin()
+		defer callStats.end()
 
 		// Panics still need to surface as JSON-RPC errors via
 		// server.WithRecovery, but that path bypasses the completion-log
@@ -214,6 +333,7 @@ func registerErrorTools(mcpServer *server.MCPServer, errorServer *ErrorGeminiSer
 	// Register error handlers for all tools using shared tool definitions,
 	// stripped of TaskSupport so the degraded server stays self-consistent.
 	mcpServer.AddTool(degradedTool(GeminiAskTool), wrapHandlerWithLogger(errorServer.handleErrorResponse, "gemini_ask", logger))
+	mcpServer.AddTool(degradedTool(GeminiStatusTool), wrapHandlerWithLogger(errorServer.handleErrorResponse, "gemini_status", logger))
 
 	logger.Info("Registered error handlers for all tools")
 }
@@ -1,10 +1,164 @@
 package main
 
 import (
-	"github.com/stretchr/testify/assert"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestDegradedToolClearsExecution(t *testing.T) {
 	assert.Nil(t, degradedTool(GeminiAskTool).Execution)
 }
+
+func TestSetupGeminiServerHonoursEnabledLists(t *testing.T) {
+	base := Config{Provider: ProviderConfig{Vendor: "deepseek", APIKey: "k", BaseURL: "http://127.0.0.1:0", Model: "deepseek-v4-pro"}}
+	tests := []struct {
+		name        string
+		tools       []string
+		prompts     []string
+		wantTools   []string
+		wantPrompts int
+	}{
+		{"defaults register all", nil, nil, []string{"gemini_ask", "gemini_status"}, len(Prompts)},
+		{"subset", []string{"gemini_ask"}, []string{"code_review", "review_pr"}, []string{"gemini_ask"}, 2},
+		{"tool disabled", []string{"other_tool"}, []string{"code_review"}, nil, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := base
+			cfg.EnabledTools, cfg.EnabledPrompts = tt.tools, tt.prompts
+			mcpServer := server.NewMCPServer("test", "0", server.WithToolCapabilities(false), server.WithPromptCapabilities(false))
+			ctx := context.WithValue(context.Background(), loggerKey, Logger(NewLogger(LevelError)))
+			require.NoError(t, setupGeminiServer(ctx, mcpServer, &cfg))
+			var tools []string
+			for name := range mcpServer.ListTools() {
+				tools = append(tools, name)
+			}
+			assert.ElementsMatch(t, tt.wantTools, tools)
+			assert.Len(t, mcpServer.ListPrompts(), tt.wantPrompts)
+		})
+	}
+}
+
+func TestHandleStartupErrorRecovers(t *testing.T) {
+	valid := &Config{Provider: ProviderConfig{Vendor: "deepseek", APIKey: "k", BaseURL: "http://127.0.0.1:0", Model: "deepseek-v4-pro"}}
+	unusable := &Config{Provider: ProviderConfig{Vendor: "unknown-vendor"}}
+
+	tests := []struct {
+		name      string
+		interval  string
+		configs   []*Config // nil entries fail NewConfig
+		wantTools []string
+	}{
+		{"config load heals", "1ms", []*Config{nil, nil, valid}, []string{"gemini_ask", "gemini_status"}},
+		{"provider setup heals", "1ms", []*Config{unusable, unusable, valid}, []string{"gemini_ask", "gemini_status"}},
+		{"retry disabled", "", []*Config{nil, valid}, []string{"gemini_ask", "gemini_status"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			origConfig, origServe := newConfigFn, serveStdioFn
+			t.Cleanup(func() { newConfigFn, serveStdioFn = origConfig, origServe })
+			t.Setenv("GEMINI_STARTUP_RETRY_INTERVAL", tt.interval)
+			t.Setenv("GEMINI_LOG_LEVEL", "error")
+
+			var mu sync.Mutex
+			calls := 0
+			newConfigFn = func(Logger) (*Config, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				cfg := tt.configs[min(calls, len(tt.configs)-1)]
+				calls++
+				if cfg == nil {
+					return nil, errors.New("PROVIDER_API_KEY is required")
+				}
+				copied := *cfg
+				return &copied, nil
+			}
+			var served *server.MCPServer
+			serveStdioFn = func(s *server.MCPServer, _ ...server.StdioOption) error {
+				served = s
+				if tt.interval != "" {
+					assert.Eventually(t, func() bool {
+						ask, status := s.GetTool("gemini_ask"), s.GetTool("gemini_status")
+						if ask == nil || status == nil || ask.Tool.Execution != nil {
+							return false
+						}
+						// The degraded gemini_status reports the startup error.
+						result, err := status.Handler(context.Background(), mcp.CallToolRequest{})
+						return err == nil && !result.IsError
+					}, 5*time.Second, time.Millisecond)
+				}
+				return nil
+			}
+
+			assert.Equal(t, 0, runMain(nil))
+			require.NotNil(t, served)
+			var tools []string
+			for name, tool := range served.ListTools() {
+				tools = append(tools, name)
+				assert.Nil(t, tool.Tool.Execution, "%s must not claim task support on a server without tasks", name)
+			}
+			assert.ElementsMatch(t, tt.wantTools, tools)
+			if tt.interval == "" {
+				mu.Lock()
+				assert.Equal(t, 1, calls, "no retry without GEMINI_STARTUP_RETRY_INTERVAL")
+				mu.Unlock()
+				status := callTool(t, served, "gemini_status")
+				assert.True(t, status.IsError)
+				assert.Contains(t, toolResultText(t, status), "PROVIDER_API_KEY is required")
+			}
+		})
+	}
+}
+
+// callTool invokes a registered tool's handler directly.
+func callTool(t *testing.T, s *server.MCPServer, name string) *mcp.CallToolResult {
+	t.Helper()
+	tool := s.GetTool(name)
+	require.NotNil(t, tool, "%s must be registered", name)
+	req := mcp.CallToolRequest{Params: mcp.CallToolParams{Name: name}}
+	result, err := tool.Handler(context.Background(), req)
+	require.NoError(t, err)
+	return result
+}
+
+func TestReinitializeRereadsConfigFile(t *testing.T) {
+	withCleanEnv(t)
+	path := filepath.Join(t.TempDir(), "cfg.yaml")
+	t.Setenv("GEMINI_CONFIG_FILE", path)
+	write := func(model string) {
+		content := "PROVIDER: deepseek\nPROVIDER_API_KEY: key\nPROVIDER_BASE_URL: http://127.0.0.1:0\nPROVIDER_MODEL: " + model + "\n"
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	}
+	retry := reinitialize(&cliFlags{geminiTemperature: -1}, NewLogger(LevelError))
+	mcpServer := server.NewMCPServer("test", "0", server.WithToolCapabilities(false))
+	ctx := context.WithValue(context.Background(), loggerKey, NewLogger(LevelError))
+
+	write("bogus")
+	err := retry(ctx, mcpServer)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "bogus")
+
+	write("deepseek-v4-pro")
+	require.NoError(t, retry(ctx, mcpServer))
+	assert.NotNil(t, mcpServer.GetTool("gemini_ask"))
+}
+
+func TestRetryStartupStopsWhenContextEnds(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	mcpServer := server.NewMCPServer("test", "0", server.WithToolCapabilities(false))
+	retry := func(context.Context, *server.MCPServer) error {
+		cancel()
+		return errors.New("still failing")
+	}
+	assert.False(t, retryStartup(ctx, mcpServer, retry, time.Millisecond, NewLogger(LevelError)))
+}
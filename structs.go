@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"regexp"
+	"text/template"
 	"time"
 
 	"github.com/mark3labs/mcp-go/mcp"
@@ -46,6 +48,9 @@ func NewPromptDefinition(name, description string) *PromptDefinition {
 }
 
 // GeminiServer implements the ToolHandler interface for provider API interactions.
+// It is immutable after NewGeminiServer returns: the provider SDK clients and
+// http.Client are safe for concurrent use, and credentials travel in their
+// configs rather than process env, so concurrent handlers need no locking.
 type GeminiServer struct {
 	config   *Config
 	provider Provider
@@ -54,13 +59,25 @@ type GeminiServer struct {
 	// provider is not an option for thinking-forced preview models: the
 	// prequalify→generation pair wedges the generation in production.
 	prequalifier Provider
-	httpClient   *http.Client
+	// escalator retries empty answers on a larger model (see
+	// Config.EscalationMap); nil unless GEMINI_ESCALATE_ON_EMPTY applies.
+	escalator Provider
+	// failover serves a request when the primary provider fails with a
+	// transient error; nil unless FAILOVER_PROVIDER is set.
+	failover Provider
+	// failoverEscalator is escalator's counterpart for answers served by
+	// failover; nil unless GEMINI_ESCALATE_ON_EMPTY applies to its model.
+	failoverEscalator Provider
+	httpClient        *http.Client
 }
 
 // Config holds all configuration parameters for the application
 type Config struct {
 	// Provider selects the model backend and carries its connection settings.
 	Provider ProviderConfig
+	// FailoverProvider is the optional secondary backend (FAILOVER_PROVIDER*)
+	// used when the primary fails with a transient error; nil disables it.
+	FailoverProvider *ProviderConfig
 
 	// Generation settings
 	GeminiTemperature float64
@@ -97,8 +114,11 @@ type Config struct {
 	MaxConcurrentTasks int // Upper bound on concurrently-executing task tools. <=0 disables.
 
 	// Authentication settings
-	AuthEnabled   bool   // Enable JWT authentication for HTTP transport
-	AuthSecretKey string // Secret key for JWT signing and verification
+	AuthEnabled   bool     // Enable JWT authentication for HTTP transport
+	AuthSecretKey string   // Secret key for JWT signing and verification
+	AuthJWKSURL   string   // JWKS endpoint for RS256 verification (GEMINI_AUTH_JWKS_URL)
+	AuthIssuers   []string // Accepted JWT iss values (GEMINI_AUTH_ISSUER)
+	AuthAudiences []string // Accepted JWT aud values (GEMINI_AUTH_AUDIENCE)
 
 	// Retry settings
 	MaxRetries     int
@@ -108,14 +128,44 @@ type Config struct {
 	// GitHub settings
 	GitHubToken               string // Token for private repo access
 	GitHubAPIBaseURL          string // For GitHub Enterprise
+	GitHubRawHost             string // Raw-content host for unauthenticated file fetches; empty uses the API (GEMINI_GITHUB_RAW_HOST)
+	DefaultGitHubRepo         string // github_repo used when a call omits it (GEMINI_DEFAULT_GITHUB_REPO)
+	DefaultGitHubRef          string // github_ref used with the default repo when a call omits it (GEMINI_DEFAULT_GITHUB_REF)
 	MaxGitHubFiles            int    // Max number of files per call
 	MaxGitHubFileSize         int64  // Max size per file in bytes
+	MinFileSize               int64  // Files smaller than this are skipped; 0 keeps all (GEMINI_MIN_FILE_SIZE)
+	MaxGitHubTotalBytes       int64  // Max bytes across all github_files of one call; 0 = no cap
 	MaxGitHubDiffBytes        int64  // Max bytes of a single unified diff payload (PR / commit / compare)
 	MaxGitHubCommits          int    // Max number of commits accepted via github_commits
+	MaxGitHubTreeEntries      int    // Max paths listed by github_tree
 	MaxGitHubPRReviewComments int    // Max number of PR review comments fetched
+	AutoIncludeReadme         bool   // Default for include_readme (GEMINI_AUTO_INCLUDE_README)
 
 	// Pre-qualification settings
 	Prequalify bool // Enable query pre-qualification for automatic system prompt selection
+
+	// EscalateOnEmpty retries an empty, non-filtered answer once on the
+	// vendor's larger model (GEMINI_ESCALATE_ON_EMPTY).
+	EscalateOnEmpty bool
+	// EscalationMap maps a model to its escalation target
+	// (GEMINI_ESCALATION_MAP); nil uses defaultEscalationMap.
+	EscalationMap map[string]string
+
+	// Registration settings; nil registers every tool / prompt.
+	EnabledTools   []string // Tool names exposed to clients (GEMINI_ENABLED_TOOLS)
+	EnabledPrompts []string // Prompt names exposed to clients (GEMINI_ENABLED_PROMPTS)
+
+	// Response settings
+	ResponseTemplate *template.Template // Optional reshaping of the answer text (GEMINI_RESPONSE_TEMPLATE)
+	AppendMetadata   bool               // Append a trailing metadata line to stdio answers (GEMINI_APPEND_METADATA)
+	ResponseEnvelope bool               // Return answers as a JSON envelope (GEMINI_RESPONSE_ENVELOPE)
+
+	// Policy settings
+	QueryDenyPatterns []*regexp.Regexp // Queries matching any pattern are rejected (GEMINI_QUERY_DENY_PATTERNS)
+
+	// Trace settings
+	TraceDir          string // Directory for per-request JSON traces; empty disables (GEMINI_TRACE_DIR)
+	TraceFileContents bool   // Include the full user envelope with file contents (GEMINI_TRACE_FILE_CONTENTS)
 }
 
 // ActiveModel returns the configured model for the selected provider.
@@ -126,12 +176,25 @@ func (c *Config) ActiveModel() string {
 	return c.Provider.Model
 }
 
+// escalationTarget returns the model GEMINI_ESCALATE_ON_EMPTY retries model
+// with, and whether it has one.
+func (c *Config) escalationTarget(model string) (string, bool) {
+	m := c.EscalationMap
+	if m == nil {
+		m = defaultEscalationMap
+	}
+	target, ok := m[model]
+	return target, ok
+}
+
 // FileUploadRequest represents a request to upload a file
 type FileUploadRequest struct {
 	FileName    string `json:"filename"`
 	MimeType    string `json:"mime_type"`
 	Content     []byte `json:"content"`
 	DisplayName string `json:"display_name,omitempty"`
+	// pinned keeps the upload first regardless of file_priority.
+	pinned bool
 }
 
 // contextInventory records which GitHub-sourced context blocks were attached
@@ -141,6 +204,7 @@ type FileUploadRequest struct {
 type contextInventory struct {
 	Repo     string // "owner/repo" (empty if no GitHub context was used)
 	Files    fileInventory
+	Tree     *treeInventory
 	PR       *prInventory
 	Commits  []commitInventory
 	Diff     *diffInventory
@@ -151,6 +215,26 @@ type contextInventory struct {
 type fileInventory struct {
 	Count int
 	Ref   string
+	// Fetched, Failed and Skipped record the per-path outcome of
+	// github_files so the result can tell the client when an answer rests on
+	// partial context. Skipped paths fell below GEMINI_MIN_FILE_SIZE.
+	Fetched []string
+	Failed  []fileFetchFailure
+	Skipped []string
+}
+
+// contextFile describes one file attached to a gemini_ask request, as
+// reported in _meta.context_files.
+type contextFile struct {
+	Name     string `json:"name"`
+	Size     int    `json:"size"`
+	MIMEType string `json:"mime_type"`
+}
+
+// fileFetchFailure is one github_files path that could not be attached.
+type fileFetchFailure struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
 }
 
 // prInventory describes a PR bundle attached to the request.
@@ -168,6 +252,13 @@ type commitInventory struct {
 	Truncated bool
 }
 
+// treeInventory describes a directory listing attached via github_tree.
+type treeInventory struct {
+	Ref       string
+	Entries   int
+	Truncated bool
+}
+
 // diffInventory describes a compare-refs diff attached to the request.
 type diffInventory struct {
 	Base      string
@@ -180,7 +271,7 @@ func (ci *contextInventory) HasAny() bool {
 	if ci == nil {
 		return false
 	}
-	return ci.Files.Count > 0 || ci.PR != nil || len(ci.Commits) > 0 || ci.Diff != nil
+	return ci.Files.Count > 0 || ci.Tree != nil || ci.PR != nil || len(ci.Commits) > 0 || ci.Diff != nil
 }
 
 // ErrorGeminiServer implements the ToolHandler interface but returns error responses
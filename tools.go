@@ -14,8 +14,10 @@ var GeminiAskTool = mcp.NewTool(
 	mcp.WithIdempotentHintAnnotation(true),
 	mcp.WithOpenWorldHintAnnotation(true),
 	mcp.WithString("query", mcp.Required(), mcp.Description("The coding question or task")),
-	mcp.WithString("github_repo", mcp.Description("Required. Must be always provided when any github_* context parameter is used!")),
-	mcp.WithString("github_ref", mcp.Description("Optional: Git branch, tag, or commit SHA. Applies only to 'github_files'.")),
+	mcp.WithString("github_repo", mcp.Description(
+		"Required when any github_* context parameter is used, unless the server sets a default repository.")),
+	mcp.WithString("github_ref", mcp.Description(
+		"Optional: Git branch, tag, or commit SHA. Applies to 'github_files' and 'github_tree'; defaults to the server's default ref for its default repository.")),
 	mcp.WithArray(
 		"github_files",
 		mcp.Description(
@@ -24,10 +26,31 @@ var GeminiAskTool = mcp.NewTool(
 		),
 		mcp.WithStringItems(),
 	),
+	mcp.WithObject(
+		"file_priority",
+		mcp.Description(
+			"Optional: map of github_files path to integer priority, e.g. {\"main.go\": 10}. "+
+				"Higher-priority files are placed earlier in the context; unlisted files default to 0; ties keep path order.",
+		),
+		mcp.AdditionalProperties(map[string]any{"type": "integer"}),
+	),
+	mcp.WithBoolean("include_readme", mcp.Description(
+		"Optional: with any GitHub context, also fetch the repository README at github_ref and place it first among the files. "+
+			"Defaults to the server's GEMINI_AUTO_INCLUDE_README setting.")),
+	mcp.WithBoolean("github_tree", mcp.Description(
+		"Optional: when true, attach the recursive directory listing of github_repo at github_ref (paths only, no file contents).")),
+	mcp.WithString("github_token", mcp.Description(
+		"Optional: GitHub token used instead of the server's for this call only, e.g. for repos only you can read. "+
+			"Over HTTP it is accepted only on authenticated requests. It is never logged.")),
 	mcp.WithNumber("github_pr", mcp.Description("Optional: pull request number in github_repo.")),
 	mcp.WithArray("github_commits", mcp.Description("Optional: array of commit SHAs (short or full), e.g. [\"a1b2c3d\"]."), mcp.WithStringItems()),
 	mcp.WithString("github_diff_base", mcp.Description("Optional: base ref for a GitHub compare diff; must be paired with github_diff_head.")),
 	mcp.WithString("github_diff_head", mcp.Description("Optional: head ref for a GitHub compare diff; must be paired with github_diff_base.")),
+	mcp.WithBoolean("include_usage", mcp.Description(
+		"Optional: when true, a second content item reports token usage as JSON "+
+			"{\"usage\": {prompt_tokens, output_tokens, reasoning_tokens, cached_tokens, total_tokens}}.")),
+	mcp.WithBoolean("timing", mcp.Description(
+		"Optional: when true, _meta.timing reports fetch_ms, upload_ms, generate_ms and total_ms for this call.")),
 	// The schema is strict: with server-side input validation enabled
 	// (WithInputSchemaValidation + WithStrictInputSchemaDefault), unknown
 	// arguments such as the removed model controls (model, thinking_level)
@@ -36,3 +59,16 @@ var GeminiAskTool = mcp.NewTool(
 	mcp.WithSchemaAdditionalProperties(false),
 	mcp.WithTaskSupport(mcp.TaskSupportOptional),
 )
+
+var GeminiStatusTool = mcp.NewTool(
+	"gemini_status",
+	mcp.WithDescription(
+		"gemini_status reports server load and configuration as JSON: active_requests (including this call), "+
+			"total_requests completed, uptime_seconds, and the configured provider vendor and model."),
+	mcp.WithTitleAnnotation("Server Status"),
+	mcp.WithReadOnlyHintAnnotation(true),
+	mcp.WithDestructiveHintAnnotation(false),
+	mcp.WithIdempotentHintAnnotation(false),
+	mcp.WithOpenWorldHintAnnotation(false),
+	mcp.WithSchemaAdditionalProperties(false),
+)
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// traceRecord is one GEMINI_TRACE_DIR file: a completed gemini_ask call
+// captured for offline prompt evaluation. Envelope holds the full user turn
+// (including attached file contents) and is only written when
+// GEMINI_TRACE_FILE_CONTENTS is enabled.
+type traceRecord struct {
+	Timestamp    time.Time `json:"timestamp"`
+	Vendor       string    `json:"vendor"`
+	Model        string    `json:"model"`
+	Fingerprint  string    `json:"request_fingerprint,omitempty"`
+	Query        string    `json:"query"`
+	Files        []string  `json:"files,omitempty"`
+	SystemPrompt string    `json:"system_prompt"`
+	Envelope     string    `json:"envelope,omitempty"`
+	Response     string    `json:"response"`
+	FinishReason string    `json:"finish_reason"`
+	Usage        UsageInfo `json:"usage"`
+	ElapsedMS    int64     `json:"elapsed_ms"`
+}
+
+// writeTrace records a completed provider call under GEMINI_TRACE_DIR, served
+// by the provider in served. Tracing is best-effort: failures are logged and
+// never affect the tool result.
+func (s *GeminiServer) writeTrace(
+	req mcp.CallToolRequest, genReq GenerationRequest, served ProviderConfig, resp *GenerationResponse, elapsed time.Duration, logger Logger,
+) {
+	if s.config.TraceDir == "" || resp == nil {
+		return
+	}
+	record := traceRecord{
+		Timestamp:    time.Now().UTC(),
+		Vendor:       served.Vendor,
+		Model:        resp.Model,
+		Fingerprint:  requestFingerprint(served, genReq),
+		Query:        extractArgumentString(req, "query"),
+		Files:        extractArgumentStringArray(req, "github_files"),
+		SystemPrompt: genReq.SystemPrompt,
+		Response:     resp.Text,
+		FinishReason: resp.FinishReason,
+		Usage:        resp.Usage,
+		ElapsedMS:    elapsed.Milliseconds(),
+	}
+	if record.Model == "" {
+		record.Model = served.Model
+	}
+	if s.config.TraceFileContents {
+		var b strings.Builder
+		for _, part := range genReq.Parts {
+			b.WriteString(part.Text)
+		}
+		record.Envelope = b.String()
+	}
+	secrets := s.traceSecrets()
+	if token := extractArgumentString(req, "github_token"); token != "" {
+		secrets = append(secrets, token)
+	}
+	if err := writeTraceRecord(s.config.TraceDir, redactTraceRecord(record, secrets)); err != nil {
+		logger.Warn("GEMINI_TRACE_DIR: failed to write trace: %v", err)
+	}
+}
+
+// traceSecrets lists the configured credentials that must never reach a
+// trace file, e.g. when a user pastes a token into the query.
+func (s *GeminiServer) traceSecrets() []string {
+	candidates := []string{s.config.Provider.APIKey, s.config.GitHubToken, s.config.AuthSecretKey}
+	if s.config.FailoverProvider != nil {
+		candidates = append(candidates, s.config.FailoverProvider.APIKey)
+	}
+	var secrets []string
+	for _, secret := range candidates {
+		if secret != "" {
+			secrets = append(secrets, secret)
+		}
+	}
+	return secrets
+}
+
+// redactTraceRecord replaces every occurrence of secrets in the free-text
+// fields of record.
+func redactTraceRecord(record traceRecord, secrets []string) traceRecord {
+	if len(secrets) == 0 {
+		return record
+	}
+	pairs := make([]string, 0, 2*len(secrets))
+	for _, secret := range secrets {
+		pairs = append(pairs, secret, "[REDACTED]")
+	}
+	r := strings.NewReplacer(pairs...)
+	record.Query = r.Replace(record.Query)
+	record.SystemPrompt = r.Replace(record.SystemPrompt)
+	record.Envelope = r.Replace(record.Envelope)
+	record.Response = r.Replace(record.Response)
+	return record
+}
+
+// writeTraceRecord writes record as an indented JSON file in dir. File names
+// sort by time; CreateTemp keeps concurrent calls from colliding and creates
+// the file with 0600 permissions.
+func writeTraceRecord(dir string, record traceRecord) error {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, fmt.Sprintf("trace-%s-*.json", record.Timestamp.Format("20060102T150405.000Z")))
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(record); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGeminiAskHandlerWritesTrace(t *testing.T) {
+	for _, tt := range []struct {
+		name         string
+		fileContents bool
+	}{
+		{"without file contents", false},
+		{"with file contents", true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "traces")
+			provider := &mockProvider{generateFn: func(context.Context, GenerationRequest) (*GenerationResponse, error) {
+				return &GenerationResponse{Text: "answer", FinishReason: "stop", Model: "deepseek-v4-pro", Usage: UsageInfo{TotalTokens: 42}}, nil
+			}}
+			s := &GeminiServer{
+				config: &Config{
+					Provider:          ProviderConfig{Vendor: "deepseek", Model: "deepseek-v4-pro", APIKey: "sk-secret"},
+					HTTPTimeout:       time.Second,
+					TraceDir:          dir,
+					TraceFileContents: tt.fileContents,
+				},
+				provider: provider,
+			}
+			req := mcp.CallToolRequest{Params: mcp.CallToolParams{Arguments: map[string]any{"query": "why does sk-secret fail?"}}}
+			_, err := s.GeminiAskHandler(context.Background(), req)
+			require.NoError(t, err)
+
+			entries, err := os.ReadDir(dir)
+			require.NoError(t, err)
+			require.Len(t, entries, 1)
+			assert.Regexp(t, `^trace-\d{8}T\d{6}\.\d{3}Z-\d+\.json$`, entries[0].Name())
+			data, err := os.ReadFile(filepath.Join(dir, entries[0].Name()))
+			require.NoError(t, err)
+
+			var record traceRecord
+			require.NoError(t, json.Unmarshal(data, &record))
+			assert.Equal(t, "deepseek", record.Vendor)
+			assert.Equal(t, "deepseek-v4-pro", record.Model)
+			assert.Equal(t, "why does [REDACTED] fail?", record.Query)
+			assert.Equal(t, "answer", record.Response)
+			assert.Equal(t, int32(42), record.Usage.TotalTokens)
+			assert.Equal(t, requestFingerprint(s.config.Provider, provider.requests()[0]), record.Fingerprint)
+			assert.NotContains(t, string(data), "sk-secret")
+			if tt.fileContents {
+				assert.Contains(t, record.Envelope, "why does [REDACTED] fail?")
+			} else {
+				assert.Empty(t, record.Envelope)
+			}
+		})
+	}
+}
+
+func TestTraceSecretsIncludeFailoverKey(t *testing.T) {
+	s := &GeminiServer{config: &Config{
+		Provider:         ProviderConfig{APIKey: "sk-primary"},
+		FailoverProvider: &ProviderConfig{APIKey: "sk-failover"},
+		GitHubToken:      "ghp-token",
+	}}
+	assert.ElementsMatch(t, []string{"sk-primary", "sk-failover", "ghp-token"}, s.traceSecrets())
+	assert.Empty(t, (&GeminiServer{config: &Config{}}).traceSecrets())
+}